@@ -0,0 +1,236 @@
+// SPDK Parser dashboard.  Lists the targets from status, loads the recent
+// samples of the selected target from api/v1/history, merges them with the
+// samples pushed on api/v1/stream and redraws the charts.  The charts are drawn
+// on plain canvases so the page works on lab machines without internet access.
+
+"use strict";
+
+// Number of samples kept, the size of the history of the target
+let maxSamples = 360;
+const colors = ["#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"];
+
+let samples = [];
+let stream = null;
+// The target shown, the responses for a target selected before are dropped
+let currentTarget = null;
+
+const targetSelect = document.getElementById("target");
+const bdevsInput = document.getElementById("bdevs");
+const state = document.getElementById("state");
+
+function formatNumber(value, unit) {
+  const prefixes = ["", "k", "M", "G", "T"];
+  let i = 0;
+  while (Math.abs(value) >= 1000 && i < prefixes.length - 1) {
+    value /= 1000;
+    i++;
+  }
+  return value.toFixed(value < 10 && i > 0 ? 1 : 0) + prefixes[i] + unit;
+}
+
+function formatBytes(value) {
+  const prefixes = ["B/s", "KiB/s", "MiB/s", "GiB/s", "TiB/s"];
+  let i = 0;
+  while (Math.abs(value) >= 1024 && i < prefixes.length - 1) {
+    value /= 1024;
+    i++;
+  }
+  return value.toFixed(value < 10 && i > 0 ? 1 : 0) + " " + prefixes[i];
+}
+
+function formatTime(time) {
+  return time.toTimeString().substring(0, 8);
+}
+
+// series is a list of {name, points: [[Date, value], ...]}
+function drawChart(id, series, format) {
+  const canvas = document.getElementById(id);
+  const ctx = canvas.getContext("2d");
+  const left = 70, right = 10, top = 10, bottom = 24;
+  const width = canvas.width - left - right;
+  const height = canvas.height - top - bottom;
+
+  ctx.clearRect(0, 0, canvas.width, canvas.height);
+  ctx.font = "11px sans-serif";
+
+  let start = Infinity, end = -Infinity, max = 0;
+  for (const s of series) {
+    for (const [time, value] of s.points) {
+      start = Math.min(start, time.getTime());
+      end = Math.max(end, time.getTime());
+      max = Math.max(max, value);
+    }
+  }
+  if (start === Infinity) {
+    ctx.fillStyle = "#888";
+    ctx.fillText("no data", left + width / 2 - 20, top + height / 2);
+    return;
+  }
+  if (end === start) {
+    end = start + 1000;
+  }
+  if (max === 0) {
+    max = 1;
+  }
+  const x = (time) => left + (time.getTime() - start) / (end - start) * width;
+  const y = (value) => top + height - value / max * height;
+
+  ctx.strokeStyle = "#e0e0e0";
+  ctx.fillStyle = "#555";
+  for (let i = 0; i <= 4; i++) {
+    const value = max * i / 4;
+    ctx.beginPath();
+    ctx.moveTo(left, y(value));
+    ctx.lineTo(left + width, y(value));
+    ctx.stroke();
+    ctx.fillText(format(value), 4, y(value) + 4);
+  }
+  ctx.fillText(formatTime(new Date(start)), left, canvas.height - 6);
+  ctx.fillText(formatTime(new Date(end)), left + width - 48, canvas.height - 6);
+
+  series.forEach((s, i) => {
+    const color = colors[i % colors.length];
+    ctx.strokeStyle = color;
+    ctx.lineWidth = 1.5;
+    ctx.beginPath();
+    s.points.forEach(([time, value], j) => {
+      if (j === 0) {
+        ctx.moveTo(x(time), y(value));
+      } else {
+        ctx.lineTo(x(time), y(value));
+      }
+    });
+    ctx.stroke();
+    ctx.lineWidth = 1;
+
+    ctx.fillStyle = color;
+    ctx.fillRect(left + 8, top + 4 + i * 14, 10, 10);
+    ctx.fillStyle = "#222";
+    ctx.fillText(s.name, left + 22, top + 13 + i * 14);
+  });
+}
+
+function selectedBdevs() {
+  return bdevsInput.value.split(",").map((name) => name.trim()).filter((name) => name !== "");
+}
+
+// One series per bdev with value(rates) computed from the bdev rates
+function bdevSeries(value) {
+  const filter = selectedBdevs();
+  const series = new Map();
+  for (const sample of samples) {
+    for (const [name, rates] of Object.entries(sample.bdevs || {})) {
+      if (filter.length > 0 && !filter.includes(name)) {
+        continue;
+      }
+      if (!series.has(name)) {
+        series.set(name, {name: name, points: []});
+      }
+      series.get(name).points.push([new Date(sample.time), value(rates)]);
+    }
+  }
+  return Array.from(series.values()).sort((a, b) => a.name.localeCompare(b.name));
+}
+
+function ocfSeries(fields) {
+  return fields.map(([name, value]) => ({
+    name: name,
+    points: samples.filter((sample) => sample.ocf).map((sample) => [new Date(sample.time), value(sample.ocf)]),
+  }));
+}
+
+function averageLatency(rates) {
+  const ops = rates.read_ops_per_sec + rates.write_ops_per_sec;
+  if (ops === 0) {
+    return 0;
+  }
+  return (rates.read_latency_us * rates.read_ops_per_sec + rates.write_latency_us * rates.write_ops_per_sec) / ops;
+}
+
+function draw() {
+  drawChart("iops", bdevSeries((r) => r.read_ops_per_sec + r.write_ops_per_sec + r.unmap_ops_per_sec), (v) => formatNumber(v, ""));
+  drawChart("bandwidth", bdevSeries((r) => r.read_bytes_per_sec + r.write_bytes_per_sec), formatBytes);
+  drawChart("latency", bdevSeries(averageLatency), (v) => v.toFixed(0) + " us");
+  drawChart("ocf_requests", ocfSeries([
+    ["hits", (o) => o.read_hits + o.write_hits],
+    ["partial misses", (o) => o.read_partial_misses + o.write_partial_misses],
+    ["full misses", (o) => o.read_full_misses + o.write_full_misses],
+    ["pass-through", (o) => o.pass_through],
+  ]), (v) => formatNumber(v, ""));
+  drawChart("ocf_hit_ratio", ocfSeries([["hit ratio", (o) => o.hit_ratio * 100]]), (v) => v.toFixed(0) + " %");
+  drawChart("ocf_usage", ocfSeries([
+    ["occupancy", (o) => o.occupancy_percent],
+    ["clean", (o) => o.clean_percent],
+    ["dirty", (o) => o.dirty_percent],
+    ["free", (o) => o.free_percent],
+  ]), (v) => v.toFixed(0) + " %");
+}
+
+// Adds the samples of the history that are older than the streamed ones, the
+// stream can deliver samples before the history request returns
+function mergeHistory(history) {
+  const first = samples.length > 0 ? new Date(samples[0].time).getTime() : Infinity;
+  const older = history.filter((sample) => new Date(sample.time).getTime() < first);
+  samples = older.concat(samples);
+  if (samples.length > maxSamples) {
+    samples.splice(0, samples.length - maxSamples);
+  }
+}
+
+function connect(target) {
+  if (stream) {
+    stream.close();
+  }
+  currentTarget = target;
+  samples = [];
+  draw();
+
+  // The stream is opened first so no sample is lost between the history and
+  // the first streamed sample
+  stream = new EventSource("api/v1/stream?target=" + encodeURIComponent(target));
+  stream.onopen = () => {
+    state.textContent = "live";
+    state.className = "live";
+  };
+  stream.onerror = () => {
+    state.textContent = "disconnected";
+    state.className = "down";
+  };
+  stream.addEventListener("sample", (event) => {
+    samples.push(JSON.parse(event.data));
+    if (samples.length > maxSamples) {
+      samples.splice(0, samples.length - maxSamples);
+    }
+    draw();
+  });
+
+  fetch("api/v1/history?target=" + encodeURIComponent(target))
+    .then((response) => response.json())
+    .then((history) => {
+      if (target !== currentTarget) {
+        return;
+      }
+      if (history.targets.length > 0) {
+        maxSamples = history.targets[0].size;
+        mergeHistory(history.targets[0].samples);
+      }
+      draw();
+    });
+}
+
+fetch("status?format=json")
+  .then((response) => response.json())
+  .then((status) => {
+    for (const report of status.targets) {
+      const option = document.createElement("option");
+      option.value = report.name;
+      option.textContent = report.name;
+      targetSelect.appendChild(option);
+    }
+    if (status.targets.length > 0) {
+      connect(targetSelect.value);
+    }
+  });
+
+targetSelect.addEventListener("change", () => connect(targetSelect.value));
+bdevsInput.addEventListener("input", draw);
@@ -0,0 +1,211 @@
+//##############################################################################
+//# spdk_accel.go
+//#
+//#
+//# Description:  Collectors for the SPDK accel framework and the iobuf buffer
+//#               pools.  They use the SPDK accel_get_stats and iobuf_get_stats
+//#               RPCs which are only available in newer SPDK versions
+//##############################################################################
+
+package main
+
+import (
+    "encoding/json"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// Definitions of strucs that will be used to parse data
+type ACCEL_operation struct {
+  Opcode string
+  Module_name string
+  Executed float64
+  Failed float64
+  Num_bytes float64
+}
+
+type ACCEL_retry struct {
+  Task float64
+  Sequence float64
+  Iobuf float64
+  Bufdesc float64
+}
+
+type AccelStat struct {
+  Sequence_executed float64
+  Sequence_failed float64
+  Operations []ACCEL_operation
+  Retry ACCEL_retry
+}
+
+type IOBUF_pool struct {
+  Cache float64
+  Main float64
+  Retry float64
+}
+
+type IOBUF_module struct {
+  Module string
+  Small_pool IOBUF_pool
+  Large_pool IOBUF_pool
+}
+
+// Definitions of metrics
+var (
+  ACCEL_executed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_accel_executed_total",
+			Help: "Number of accel operations executed",
+		},
+		[]string{"target", "opcode", "module"},
+	)
+  ACCEL_failed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_accel_failed_total",
+			Help: "Number of accel operations that failed",
+		},
+		[]string{"target", "opcode", "module"},
+	)
+  ACCEL_bytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_accel_bytes_total",
+			Help: "Number of bytes processed by accel operations",
+		},
+		[]string{"target", "opcode", "module"},
+	)
+  ACCEL_sequence_executed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_accel_sequence_executed_total",
+			Help: "Number of accel sequences executed",
+		},
+		[]string{"target"},
+	)
+  ACCEL_sequence_failed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_accel_sequence_failed_total",
+			Help: "Number of accel sequences that failed",
+		},
+		[]string{"target"},
+	)
+  ACCEL_retries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_accel_retries_total",
+			Help: "Number of times the accel framework had to retry because a resource was not available",
+		},
+		[]string{"target", "resource"},
+	)
+
+  IOBUF_cache = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_iobuf_cache_total",
+			Help: "Number of buffers taken from the iobuf channel cache",
+		},
+		[]string{"target", "module", "pool"},
+	)
+  IOBUF_main = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_iobuf_main_total",
+			Help: "Number of buffers taken from the iobuf main pool because the cache was empty",
+		},
+		[]string{"target", "module", "pool"},
+	)
+  IOBUF_retry = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_iobuf_retry_total",
+			Help: "Number of times a module had to wait for an iobuf buffer",
+		},
+		[]string{"target", "module", "pool"},
+	)
+)
+
+//##############################################################################
+//# Function: recordAccelMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if the RPC command failed or returned invalid data
+//#
+//# Description:  This function executes the RPC command accel_get_stats and
+//#               records the accel metrics per opcode and module
+//##############################################################################
+func recordAccelMetrics(target *Target) error {
+  var parsed_accel_data AccelStat
+
+  accel_json_data,err := rpcCall(target, "accel_get_stats")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(accel_json_data, &parsed_accel_data); err != nil {
+    return err
+  }
+
+  setCounter(ACCEL_sequence_executed, "spdk_accel_sequence_executed_total", prometheus.Labels{"target":target.Name}, parsed_accel_data.Sequence_executed)
+  setCounter(ACCEL_sequence_failed, "spdk_accel_sequence_failed_total", prometheus.Labels{"target":target.Name}, parsed_accel_data.Sequence_failed)
+  setCounter(ACCEL_retries, "spdk_accel_retries_total", prometheus.Labels{"target":target.Name, "resource":"task"}, parsed_accel_data.Retry.Task)
+  setCounter(ACCEL_retries, "spdk_accel_retries_total", prometheus.Labels{"target":target.Name, "resource":"sequence"}, parsed_accel_data.Retry.Sequence)
+  setCounter(ACCEL_retries, "spdk_accel_retries_total", prometheus.Labels{"target":target.Name, "resource":"iobuf"}, parsed_accel_data.Retry.Iobuf)
+  setCounter(ACCEL_retries, "spdk_accel_retries_total", prometheus.Labels{"target":target.Name, "resource":"bufdesc"}, parsed_accel_data.Retry.Bufdesc)
+
+  for _,operation := range parsed_accel_data.Operations {
+    labels := prometheus.Labels{"target":target.Name, "opcode":operation.Opcode, "module":operation.Module_name}
+    setCounter(ACCEL_executed, "spdk_accel_executed_total", labels, operation.Executed)
+    setCounter(ACCEL_failed, "spdk_accel_failed_total", labels, operation.Failed)
+    setCounter(ACCEL_bytes, "spdk_accel_bytes_total", labels, operation.Num_bytes)
+  }
+  return nil
+}
+
+//##############################################################################
+//# Function: recordIobufMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if the RPC command failed or returned invalid data
+//#
+//# Description:  This function executes the RPC command iobuf_get_stats and
+//#               records the small and large pool metrics per module
+//##############################################################################
+func recordIobufMetrics(target *Target) error {
+  var modules []IOBUF_module
+
+  iobuf_json_data,err := rpcCall(target, "iobuf_get_stats")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(iobuf_json_data, &modules); err != nil {
+    return err
+  }
+
+  for _,module := range modules {
+    pools := map[string]IOBUF_pool{"small":module.Small_pool, "large":module.Large_pool}
+    for name,pool := range pools {
+      labels := prometheus.Labels{"target":target.Name, "module":module.Module, "pool":name}
+      setCounter(IOBUF_cache, "spdk_iobuf_cache_total", labels, pool.Cache)
+      setCounter(IOBUF_main, "spdk_iobuf_main_total", labels, pool.Main)
+      setCounter(IOBUF_retry, "spdk_iobuf_retry_total", labels, pool.Retry)
+    }
+  }
+  return nil
+}
+
+//##############################################################################
+//# Function: init()
+//#
+//# Input:   None
+//# Output:  None
+//#
+//# Description:  This function registers the accel and iobuf metrics in
+//#               Prometheus and the accel and iobuf collectors
+//##############################################################################
+func init() {
+  registerMetric(ACCEL_executed)
+  registerMetric(ACCEL_failed)
+  registerMetric(ACCEL_bytes)
+  registerMetric(ACCEL_sequence_executed)
+  registerMetric(ACCEL_sequence_failed)
+  registerMetric(ACCEL_retries)
+  registerMetric(IOBUF_cache)
+  registerMetric(IOBUF_main)
+  registerMetric(IOBUF_retry)
+
+  registerCollector("accel", "accel framework operations per opcode and module (accel_get_stats)", recordAccelMetrics)
+  registerCollector("iobuf", "iobuf small and large buffer pools per module (iobuf_get_stats)", recordIobufMetrics)
+}
@@ -0,0 +1,256 @@
+//##############################################################################
+//# spdk_aggregate.go
+//#
+//#
+//# Description:  Collector that rolls up the bdev iostat data along the bdev
+//#               graph built in spdk_topology.go.  It records the traffic at the
+//#               top-level virtual bdevs and at the physical NVMe devices, the
+//#               write amplification of every stack and the share of the OCF
+//#               traffic that went to the core device
+//##############################################################################
+
+package main
+
+import (
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// Definitions of metrics
+var (
+  AGGREGATE_bytes_read = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_topology_bytes_read",
+			Help: "Number of bytes read from all the bdevs of a layer",
+		},
+		[]string{"target", "layer"},
+	)
+  AGGREGATE_bytes_written = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_topology_bytes_written",
+			Help: "Number of bytes written to all the bdevs of a layer",
+		},
+		[]string{"target", "layer"},
+	)
+  AGGREGATE_read_ops = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_topology_read_ops",
+			Help: "Number of read operations of all the bdevs of a layer",
+		},
+		[]string{"target", "layer"},
+	)
+  AGGREGATE_write_ops = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_topology_write_ops",
+			Help: "Number of write operations of all the bdevs of a layer",
+		},
+		[]string{"target", "layer"},
+	)
+  AGGREGATE_stack_bytes_read = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_stack_physical_bytes_read",
+			Help: "Number of bytes read from the physical devices under a top-level bdev",
+		},
+		[]string{"target", "bdev_name"},
+	)
+  AGGREGATE_stack_bytes_written = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_stack_physical_bytes_written",
+			Help: "Number of bytes written to the physical devices under a top-level bdev",
+		},
+		[]string{"target", "bdev_name"},
+	)
+  AGGREGATE_write_amplification = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_stack_write_amplification",
+			Help: "Bytes written to the physical devices under a top-level bdev divided by the bytes written to it during the last interval",
+		},
+		[]string{"target", "bdev_name"},
+	)
+  AGGREGATE_ocf_bypass_ratio = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_ocf_bypass_ratio",
+			Help: "Bytes transferred to the OCF core bdev divided by the bytes transferred to the OCF bdev during the last interval",
+		},
+		[]string{"target", "bdev_name", "direction"},
+	)
+)
+
+//##############################################################################
+//# Function: stackLeaves
+//#
+//# Input:   name    - the bdev at the top of the stack
+//#          parents - the parents of every bdev in the graph
+//#          visited - the bdevs already walked
+//#          leaves  - the set the leaves are added to
+//# Output:  None
+//#
+//# Description:  This function walks the graph down from a bdev and collects
+//#               the bdevs that are not built on any other bdev.  Every bdev is
+//#               walked once so a bdev shared by two branches is not walked
+//#               twice and a cycle in a broken configuration ends the walk
+//##############################################################################
+func stackLeaves(name string, parents map[string][]string, visited map[string]bool, leaves map[string]bool) {
+  if visited[name] {
+    return
+  }
+  visited[name] = true
+
+  if len(parents[name]) == 0 {
+    leaves[name] = true
+    return
+  }
+  for _,parent := range parents[name] {
+    stackLeaves(parent, parents, visited, leaves)
+  }
+}
+
+//##############################################################################
+//# Function: recordAggregateMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if the graph could not be built or the RPC command failed
+//#
+//# Description:  This function executes the RPC command get_bdevs_iostat and
+//#               records the rolled up metrics.  The bdev graph of the last
+//#               collection is reused while the bdevs stay the same, it is only
+//#               rebuilt when a bdev was created or deleted.  The
+//#               top-level bdevs are the ones no other bdev is built on, the
+//#               physical bdevs are the NVMe bdevs at the bottom of the graph.
+//#               A standalone NVMe bdev is only counted as physical.  When
+//#               several stacks share a physical device the traffic of that
+//#               device is counted in each of them
+//##############################################################################
+func recordAggregateMetrics(target *Target) error {
+  parsed_iostat_data,err := fetchIostat(target)
+  if err != nil {
+    return err
+  }
+
+  topology := target.topology
+  if topology == nil || !topologyMatches(topology, parsed_iostat_data.Bdevs) {
+    topology,err = buildTopology(target)
+    if err != nil {
+      return err
+    }
+    target.topology = topology
+  }
+
+  bdevs := map[string]Bdev{}
+  for _,bdev := range parsed_iostat_data.Bdevs {
+    bdevs[bdev.Name] = bdev
+  }
+
+  drivers := map[string]string{}
+  for _,node := range topology.Nodes {
+    drivers[node.Name] = node.Driver
+  }
+
+  parents := map[string][]string{}
+  has_children := map[string]bool{}
+  for _,edge := range topology.Edges {
+    if edge.Relation == "nvmf_namespace" {
+      continue
+    }
+    parents[edge.Name] = append(parents[edge.Name], edge.Parent)
+    has_children[edge.Parent] = true
+  }
+
+  // delta returns how much a counter of a bdev grew since the last collection
+  delta := func(name string, value func(Bdev) float64) float64 {
+    last,seen := target.aggregateBdevs[name]
+    if !seen || value(bdevs[name]) < value(last) {
+      return 0
+    }
+    return value(bdevs[name]) - value(last)
+  }
+  bytes_read := func(bdev Bdev) float64 { return bdev.Bytes_read }
+  bytes_written := func(bdev Bdev) float64 { return bdev.Bytes_written }
+
+  series := newSeriesSet(target, "aggregate")
+
+  layers := map[string]*Bdev{"virtual": {}, "physical": {}}
+  for name,bdev := range bdevs {
+    // Every bdev is in one layer at most, a standalone NVMe bdev is physical
+    layer := ""
+    if len(parents[name]) == 0 && drivers[name] == "nvme" {
+      layer = "physical"
+    } else if !has_children[name] {
+      layer = "virtual"
+    }
+    if total,ok := layers[layer]; ok {
+      total.Bytes_read += bdev.Bytes_read
+      total.Bytes_written += bdev.Bytes_written
+      total.Num_read_ops += bdev.Num_read_ops
+      total.Num_write_ops += bdev.Num_write_ops
+    }
+
+    // Only bdevs built on other bdevs form a stack
+    if has_children[name] || len(parents[name]) == 0 {
+      continue
+    }
+    leaves := map[string]bool{}
+    stackLeaves(name, parents, map[string]bool{}, leaves)
+
+    var physical_read, physical_written, physical_written_delta float64
+    for leaf := range leaves {
+      if drivers[leaf] != "nvme" {
+        continue
+      }
+      physical_read += bdevs[leaf].Bytes_read
+      physical_written += bdevs[leaf].Bytes_written
+      physical_written_delta += delta(leaf, bytes_written)
+    }
+    labels := prometheus.Labels{"target":target.Name, "bdev_name":name}
+    setSeries(series, AGGREGATE_stack_bytes_read, labels, physical_read)
+    setSeries(series, AGGREGATE_stack_bytes_written, labels, physical_written)
+    if written := delta(name, bytes_written); written > 0 {
+      setSeries(series, AGGREGATE_write_amplification, labels, physical_written_delta / written)
+    }
+  }
+
+  for layer,total := range layers {
+    labels := prometheus.Labels{"target":target.Name, "layer":layer}
+    setSeries(series, AGGREGATE_bytes_read, labels, total.Bytes_read)
+    setSeries(series, AGGREGATE_bytes_written, labels, total.Bytes_written)
+    setSeries(series, AGGREGATE_read_ops, labels, total.Num_read_ops)
+    setSeries(series, AGGREGATE_write_ops, labels, total.Num_write_ops)
+  }
+
+  for _,edge := range topology.Edges {
+    if edge.Relation != "ocf_core" {
+      continue
+    }
+    if read := delta(edge.Name, bytes_read); read > 0 {
+      setSeries(series, AGGREGATE_ocf_bypass_ratio, prometheus.Labels{"target":target.Name, "bdev_name":edge.Name, "direction":"read"}, delta(edge.Parent, bytes_read) / read)
+    }
+    if written := delta(edge.Name, bytes_written); written > 0 {
+      setSeries(series, AGGREGATE_ocf_bypass_ratio, prometheus.Labels{"target":target.Name, "bdev_name":edge.Name, "direction":"write"}, delta(edge.Parent, bytes_written) / written)
+    }
+  }
+
+  target.aggregateBdevs = bdevs
+  deleteStaleSeries(series)
+  return nil
+}
+
+//##############################################################################
+//# Function: init()
+//#
+//# Input:   None
+//# Output:  None
+//#
+//# Description:  This function registers the aggregated metrics in Prometheus
+//#               and the aggregate collector
+//##############################################################################
+func init() {
+  registerMetric(AGGREGATE_bytes_read)
+  registerMetric(AGGREGATE_bytes_written)
+  registerMetric(AGGREGATE_read_ops)
+  registerMetric(AGGREGATE_write_ops)
+  registerMetric(AGGREGATE_stack_bytes_read)
+  registerMetric(AGGREGATE_stack_bytes_written)
+  registerMetric(AGGREGATE_write_amplification)
+  registerMetric(AGGREGATE_ocf_bypass_ratio)
+
+  registerCollector("aggregate", "bdev traffic rolled up along the bdev graph, write amplification and OCF bypass ratios", recordAggregateMetrics)
+}
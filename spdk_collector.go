@@ -0,0 +1,189 @@
+//##############################################################################
+//# spdk_collector.go
+//#
+//#
+//# Description:  Collectors for spdk_parser.  Each collector gathers one
+//#               family of SPDK statistics through an RPC method and registers
+//#               itself here so it can be enabled with -collectors or -target
+//##############################################################################
+
+package main
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+type Collector struct {
+  Help string
+  Collect func(target *Target) error
+}
+
+// All the collectors, keyed by the name used in -collectors
+var collectors = map[string]Collector{}
+
+// All the metrics registered with registerMetric
+var metrics []prometheus.Collector
+
+// Last value seen for every counter set with setCounter
+var (
+  counterValues = map[string]float64{}
+  counterMutex sync.Mutex
+)
+
+//##############################################################################
+//# Function: registerCollector
+//#
+//# Input:   name    - the name used to enable the collector
+//#          help    - a short description shown in the usage text
+//#          collect - the function that gathers and records the metrics
+//# Output:  None
+//#
+//# Description:  This function adds a collector to the list of collectors that
+//#               can be enabled.  It is called from init()
+//##############################################################################
+func registerCollector(name string, help string, collect func(target *Target) error) {
+  collectors[name] = Collector{Help: help, Collect: collect}
+}
+
+//##############################################################################
+//# Function: registerMetric
+//#
+//# Input:   metric - the metric to register
+//# Output:  None
+//#
+//# Description:  This function registers a metric in Prometheus and remembers
+//#               it so the series of a target can be removed from every metric
+//##############################################################################
+func registerMetric(metric prometheus.Collector) {
+  prometheus.MustRegister(metric)
+  metrics = append(metrics, metric)
+}
+
+//##############################################################################
+//# Function: collectorNames
+//#
+//# Input:   None
+//# Output:  The sorted names of all the collectors
+//#
+//# Description:  This function lists the collectors that can be enabled
+//##############################################################################
+func collectorNames() []string {
+  var names []string
+  for name := range collectors {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  return names
+}
+
+//##############################################################################
+//# Function: parseCollectors
+//#
+//# Input:   list - comma separated list of collector names
+//# Output:  The collector names and an error if one of them is unknown
+//#
+//# Description:  This function validates the value given to -collectors
+//##############################################################################
+func parseCollectors(list string) ([]string, error) {
+  var names []string
+  for _,name := range strings.Split(list, ",") {
+    name = strings.TrimSpace(name)
+    if name == "" {
+      continue
+    }
+    if _,ok := collectors[name]; !ok {
+      return nil, fmt.Errorf("unknown collector %q, available collectors are: %s", name, strings.Join(collectorNames(), ","))
+    }
+    names = append(names, name)
+  }
+  return names, nil
+}
+
+//##############################################################################
+//# Function: boolToFloat
+//#
+//# Input:   value - the boolean to convert
+//# Output:  1 if value is true, 0 otherwise
+//#
+//# Description:  This function converts a boolean into a metric value
+//##############################################################################
+func boolToFloat(value bool) float64 {
+  if value {
+    return 1
+  }
+  return 0
+}
+
+//##############################################################################
+//# Function: counterID
+//#
+//# Input:   name   - the metric name
+//#          labels - the labels of the counter
+//# Output:  The key of the counter in counterValues
+//#
+//# Description:  This function builds the key of a counter from its name and
+//#               its labels sorted by name
+//##############################################################################
+func counterID(name string, labels prometheus.Labels) string {
+  var keys []string
+  for key := range labels {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+
+  id := name
+  for _,key := range keys {
+    id += "," + key + "=" + labels[key]
+  }
+  return id
+}
+
+//##############################################################################
+//# Function: setCounter
+//#
+//# Input:   counter - the counter to update
+//#          name    - the metric name, used to remember the last value
+//#          labels  - the labels of the counter
+//#          value   - the cumulative value reported by SPDK
+//# Output:  None
+//#
+//# Description:  SPDK reports totals while Prometheus counters can only be
+//#               incremented, so this function adds the difference with the
+//#               last value seen.  If the value went down SPDK was restarted
+//#               and the whole value is added
+//##############################################################################
+func setCounter(counter *prometheus.CounterVec, name string, labels prometheus.Labels, value float64) {
+  id := counterID(name, labels)
+
+  counterMutex.Lock()
+  defer counterMutex.Unlock()
+
+  last,seen := counterValues[id]
+  if !seen || value < last {
+    last = 0
+  }
+  counter.With(labels).Add(value - last)
+  counterValues[id] = value
+}
+
+//##############################################################################
+//# Function: forgetCounter
+//#
+//# Input:   name   - the metric name
+//#          labels - the labels of the deleted counter
+//# Output:  None
+//#
+//# Description:  This function forgets the last value of a counter whose
+//#               series was deleted, so a series created again later starts
+//#               from the value reported by SPDK
+//##############################################################################
+func forgetCounter(name string, labels prometheus.Labels) {
+  counterMutex.Lock()
+  defer counterMutex.Unlock()
+  delete(counterValues, counterID(name, labels))
+}
@@ -0,0 +1,106 @@
+//##############################################################################
+//# spdk_collector_test.go
+//#
+//#
+//# Description:  Tests of the helpers shared by the collectors
+//##############################################################################
+
+package main
+
+import (
+    "testing"
+
+    "github.com/prometheus/client_golang/prometheus"
+    dto "github.com/prometheus/client_model/go"
+)
+
+//##############################################################################
+//# Function: TestSetCounter
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks that the totals reported by SPDK are
+//#               added to the counter, including after a restart of SPDK
+//##############################################################################
+func TestSetCounter(t *testing.T) {
+  tests := []struct {
+    name string
+    values []float64
+    expected float64
+  }{
+    {name: "increasing", values: []float64{10, 15, 40}, expected: 40},
+    {name: "unchanged", values: []float64{7, 7, 7}, expected: 7},
+    {name: "restart", values: []float64{10, 15, 5, 8}, expected: 23},
+    {name: "restart to zero", values: []float64{10, 0, 3}, expected: 13},
+  }
+
+  // Forget the values remembered by a previous run of the test
+  removeTarget(newTarget("test"))
+
+  for _,test := range tests {
+    counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "spdk_test_total", Help: "Test counter"}, []string{"target", "case"})
+    labels := prometheus.Labels{"target":"test", "case":test.name}
+    for _,value := range test.values {
+      setCounter(counter, "spdk_test_total", labels, value)
+    }
+
+    var metric dto.Metric
+    if err := counter.With(labels).Write(&metric); err != nil {
+      t.Fatal(err)
+    }
+    if metric.GetCounter().GetValue() != test.expected {
+      t.Errorf("%s: counter is %v after %v, expected %v", test.name, metric.GetCounter().GetValue(), test.values, test.expected)
+    }
+  }
+}
+
+//##############################################################################
+//# Function: TestDeleteStaleSeries
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks that only the series not set again by a
+//#               collection are deleted, even when the labels map is reused
+//##############################################################################
+func TestDeleteStaleSeries(t *testing.T) {
+  target := newTarget("test")
+  gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "spdk_test", Help: "Test gauge"}, []string{"target", "bdev_name"})
+
+  series := newSeriesSet(target, "test")
+  labels := prometheus.Labels{"target":"test"}
+  for _,name := range []string{"Nvme0n1", "Nvme1n1", "Cache1"} {
+    labels["bdev_name"] = name
+    setSeries(series, gauge, labels, 1)
+  }
+  deleteStaleSeries(series)
+
+  series = newSeriesSet(target, "test")
+  setSeries(series, gauge, prometheus.Labels{"target":"test", "bdev_name":"Nvme0n1"}, 2)
+  setSeries(series, gauge, prometheus.Labels{"target":"test", "bdev_name":"Nvme2n1"}, 3)
+  deleteStaleSeries(series)
+
+  expected := map[string]float64{"Nvme0n1": 2, "Nvme2n1": 3}
+  metrics := make(chan prometheus.Metric, 10)
+  gauge.Collect(metrics)
+  close(metrics)
+  found := map[string]float64{}
+  for metric := range metrics {
+    var written dto.Metric
+    metric.Write(&written)
+    for _,label := range written.GetLabel() {
+      if label.GetName() == "bdev_name" {
+        found[label.GetValue()] = written.GetGauge().GetValue()
+      }
+    }
+  }
+  if len(found) != len(expected) {
+    t.Errorf("found series %v, expected %v", found, expected)
+  }
+  for name,value := range expected {
+    if found[name] != value {
+      t.Errorf("series %s is %v, expected %v", name, found[name], value)
+    }
+  }
+}
@@ -0,0 +1,38 @@
+//##############################################################################
+//# spdk_dashboard.go
+//#
+//#
+//# Description:  Built-in web dashboard served at /.  The page is embedded in
+//#               the binary and draws live charts of the bdev IOPS, bandwidth
+//#               and latency and of the OCF requests and occupancy from
+//#               /api/v1/history and /api/v1/stream, so a lab machine without
+//#               Prometheus and Grafana can still watch its SPDK applications
+//##############################################################################
+
+package main
+
+import (
+    "embed"
+    "io/fs"
+    "net/http"
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+//##############################################################################
+//# Function: dashboardHandler
+//#
+//# Input:   None
+//# Output:  The handler serving the files of the dashboard
+//#
+//# Description:  This function serves the embedded dashboard directory at the
+//#               root of the web server
+//##############################################################################
+func dashboardHandler() http.Handler {
+  files,err := fs.Sub(dashboardFiles, "dashboard")
+  if err != nil {
+    panic(err)
+  }
+  return http.FileServer(http.FS(files))
+}
@@ -0,0 +1,229 @@
+//##############################################################################
+//# spdk_dump.go
+//#
+//#
+//# Description:  spdk_parser dump runs the collectors of every target once and
+//#               prints the metrics on stdout instead of serving them, for cron
+//#               jobs, support bundles or checking that a new SPDK build works
+//#               with spdk_parser.  It exits with 1 when a collector, optional
+//#               or not, or the version RPC failed
+//#
+//# Usage:     spdk_parser dump [-format=prometheus|json|csv|table] [OPTIONS]
+//##############################################################################
+
+package main
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "text/tabwriter"
+
+    "github.com/prometheus/client_golang/prometheus"
+    dto "github.com/prometheus/client_model/go"
+    "github.com/prometheus/common/expfmt"
+)
+
+// A series of the dump, the target label is the target it belongs to
+type DumpMetric struct {
+  Name string `json:"name"`
+  Labels map[string]string `json:"labels"`
+  Value float64 `json:"value"`
+}
+
+// The metrics of a target as printed by -format=json
+type DumpTarget struct {
+  Target string `json:"target"`
+  Version string `json:"spdk_version,omitempty"`
+  Errors []string `json:"errors,omitempty"`
+  Metrics []DumpMetric `json:"metrics"`
+}
+
+// The output of -format=json, the host-wide series are not part of a target
+type DumpReport struct {
+  Targets []DumpTarget `json:"targets"`
+  Host []DumpMetric `json:"host"`
+}
+
+var dumpFormats = []string{"prometheus", "json", "csv", "table"}
+
+//##############################################################################
+//# Function: dumpMetrics
+//#
+//# Input:   families - the metrics gathered from Prometheus
+//#          name     - the name of the target
+//# Output:  The series of the target
+//#
+//# Description:  This function flattens the gauges and counters of the target
+//#               into one entry per series, without the target label
+//##############################################################################
+func dumpMetrics(families []*dto.MetricFamily, name string) []DumpMetric {
+  metrics := []DumpMetric{}
+  for _,family := range families {
+    for _,metric := range family.GetMetric() {
+      dump := DumpMetric{Name: family.GetName(), Labels: map[string]string{}}
+      target_name := ""
+      for _,label := range metric.GetLabel() {
+        if label.GetName() == "target" {
+          target_name = label.GetValue()
+        } else {
+          dump.Labels[label.GetName()] = label.GetValue()
+        }
+      }
+      if target_name != name {
+        continue
+      }
+      if metric.GetGauge() != nil {
+        dump.Value = metric.GetGauge().GetValue()
+      } else if metric.GetCounter() != nil {
+        dump.Value = metric.GetCounter().GetValue()
+      }
+      metrics = append(metrics, dump)
+    }
+  }
+  return metrics
+}
+
+//##############################################################################
+//# Function: formatLabels
+//#
+//# Input:   metric - a series of the dump
+//# Output:  The labels as NAME=VALUE separated by commas, sorted by name
+//#
+//# Description:  This function formats the labels of the csv and table output
+//##############################################################################
+func formatLabels(metric DumpMetric) string {
+  var labels []string
+  for name,value := range metric.Labels {
+    labels = append(labels, name + "=" + value)
+  }
+  sort.Strings(labels)
+  return strings.Join(labels, ",")
+}
+
+//##############################################################################
+//# Function: runDump
+//#
+//# Input:   format - the value of -format
+//# Output:  The exit code of spdk_parser, 1 when a collector, optional or
+//#          not, or the version RPC of a target failed and 2 when the format
+//#          is unknown
+//#
+//# Description:  This function collects every target once and prints the
+//#               SPDK metrics in the given format.  Every failed collector,
+//#               including the optional ones, and a failed version RPC are
+//#               reported on stderr so the output stays usable when a target
+//#               failed
+//##############################################################################
+func runDump(format string) int {
+  known := false
+  for _,name := range dumpFormats {
+    known = known || name == format
+  }
+  if !known {
+    fmt.Fprintln(os.Stderr, "ERROR: unknown format " + format + ", expected one of " + strings.Join(dumpFormats, ","))
+    return 2
+  }
+
+  exit_code := 0
+  var reports []DumpTarget
+  for _,target := range targets {
+    var errs []string
+    if err := detectVersion(target); err != nil {
+      errs = append(errs, "version: " + err.Error())
+    }
+    if err := collectTarget(target); err != nil {
+      errs = append(errs, strings.Split(err.Error(), "\n")...)
+    }
+    // The optional collectors do not fail the collection of the target but
+    // any failed RPC fails the dump
+    collectors := targetReport(target).Collectors
+    for _,name := range target.Collectors {
+      if status := collectors[name]; status.Optional && !status.Last_failure.IsZero() {
+        errs = append(errs, "collector " + name + " (optional): " + strings.ReplaceAll(status.Last_error, "\n", "; "))
+      }
+    }
+    report := DumpTarget{Target: target.Name, Version: targetReport(target).Version, Errors: errs}
+    for _,message := range errs {
+      fmt.Fprintln(os.Stderr, "ERROR: target " + target.Name + " " + message)
+      exit_code = 1
+    }
+    reports = append(reports, report)
+  }
+
+  families,err := prometheus.DefaultGatherer.Gather()
+  if err != nil {
+    fmt.Fprintln(os.Stderr, "ERROR: " + err.Error())
+    exit_code = 1
+  }
+  for i := range reports {
+    reports[i].Metrics = dumpMetrics(families, reports[i].Target)
+  }
+
+  // The host-wide series, like the hugepages, have no target label
+  host := []DumpMetric{}
+  for _,metric := range dumpMetrics(families, "") {
+    if strings.HasPrefix(metric.Name, "spdk_") {
+      host = append(host, metric)
+    }
+  }
+
+  switch format {
+  case "prometheus":
+    // Like the other formats, only the SPDK metrics without the metrics of
+    // the Go runtime and of the process
+    for _,family := range families {
+      if strings.HasPrefix(family.GetName(), "spdk_") {
+        expfmt.MetricFamilyToText(os.Stdout, family)
+      }
+    }
+
+  case "json":
+    encoder := json.NewEncoder(os.Stdout)
+    encoder.SetIndent("", "  ")
+    encoder.Encode(DumpReport{Targets: reports, Host: host})
+
+  case "csv":
+    writer := csv.NewWriter(os.Stdout)
+    writer.Write([]string{"target", "metric", "labels", "value"})
+    for _,report := range reports {
+      for _,metric := range report.Metrics {
+        writer.Write([]string{report.Target, metric.Name, formatLabels(metric), strconv.FormatFloat(metric.Value, 'g', -1, 64)})
+      }
+    }
+    for _,metric := range host {
+      writer.Write([]string{"", metric.Name, formatLabels(metric), strconv.FormatFloat(metric.Value, 'g', -1, 64)})
+    }
+    writer.Flush()
+
+  case "table":
+    for _,report := range reports {
+      fmt.Printf("Target %s  SPDK version: %s\n", report.Target, report.Version)
+      for _,message := range report.Errors {
+        fmt.Printf("Error: %s\n", message)
+      }
+      writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+      fmt.Fprintln(writer, "METRIC\tLABELS\tVALUE\t")
+      for _,metric := range report.Metrics {
+        fmt.Fprintf(writer, "%s\t%s\t%s\t\n", metric.Name, formatLabels(metric), strconv.FormatFloat(metric.Value, 'f', -1, 64))
+      }
+      writer.Flush()
+      fmt.Println()
+    }
+    if len(host) > 0 {
+      fmt.Println("Host")
+      writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+      fmt.Fprintln(writer, "METRIC\tLABELS\tVALUE\t")
+      for _,metric := range host {
+        fmt.Fprintf(writer, "%s\t%s\t%s\t\n", metric.Name, formatLabels(metric), strconv.FormatFloat(metric.Value, 'f', -1, 64))
+      }
+      writer.Flush()
+      fmt.Println()
+    }
+  }
+  return exit_code
+}
@@ -0,0 +1,119 @@
+//##############################################################################
+//# spdk_dump_test.go
+//#
+//#
+//# Description:  Tests of the errors and exit code of spdk_parser dump
+//##############################################################################
+
+package main
+
+import (
+    "encoding/json"
+    "io"
+    "os"
+    "strings"
+    "testing"
+)
+
+//##############################################################################
+//# Function: captureDump
+//#
+//# Input:   t      - the test
+//#          target - the only target to dump
+//#          format - the value of -format
+//# Output:  The exit code of the dump and what it printed on stdout
+//#
+//# Description:  This function runs dump on one target and keeps its output
+//#               out of the test output
+//##############################################################################
+func captureDump(t *testing.T, target *Target, format string) (int, []byte) {
+  configured := targets
+  defer func() { targets = configured }()
+  targets = []*Target{target}
+
+  stdout,stderr := os.Stdout,os.Stderr
+  defer func() { os.Stdout,os.Stderr = stdout,stderr }()
+  reader,writer,err := os.Pipe()
+  if err != nil {
+    t.Fatal(err)
+  }
+  os.Stdout = writer
+  os.Stderr,_ = os.Open(os.DevNull)
+  output := make(chan []byte)
+  go func() {
+    data,_ := io.ReadAll(reader)
+    output <- data
+  }()
+
+  exit_code := runDump(format)
+  writer.Close()
+  return exit_code, <-output
+}
+
+//##############################################################################
+//# Function: TestRunDump
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks that dump reports every failed collector,
+//#               the optional ones too, and the version RPC of a target and
+//#               exits with 1
+//##############################################################################
+func TestRunDump(t *testing.T) {
+  address,_ := startRPCServer(t, nil, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"Method not found"}}`)
+  target,err := parseTarget("name=dump,address=" + address + ",collectors=iostat,nvmf_subsystem,ocf", defaultCollectors)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer removeTarget(target)
+  target.optional["ocf"] = true
+
+  exit_code,output := captureDump(t, target, "json")
+  var report DumpReport
+  if err := json.Unmarshal(output, &report); err != nil {
+    t.Fatal(err)
+  }
+
+  if exit_code != 1 {
+    t.Errorf("runDump returned %d, expected 1", exit_code)
+  }
+  expected := []string{"version: ", "collector iostat: ", "collector nvmf_subsystem: ", "collector ocf (optional): "}
+  if len(report.Targets) != 1 || len(report.Targets[0].Errors) != len(expected) {
+    t.Fatalf("runDump reported %+v, expected one error for each of %q", report.Targets, expected)
+  }
+  for i,message := range report.Targets[0].Errors {
+    if !strings.HasPrefix(message, expected[i]) || !strings.Contains(message, "Method not found") {
+      t.Errorf("runDump reported error %q, expected %q", message, expected[i])
+    }
+  }
+}
+
+//##############################################################################
+//# Function: TestRunDumpPrometheus
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks that -format=prometheus only prints the
+//#               SPDK metrics, like the other formats
+//##############################################################################
+func TestRunDumpPrometheus(t *testing.T) {
+  address,_ := startRPCServer(t, nil, `{"jsonrpc":"2.0","id":1,"result":{"tick_rate":1000,"ticks":5000,"bdevs":[{"name":"Nvme0n1","bytes_read":4096}]}}`)
+  target,err := parseTarget("name=dump,address=" + address + ",collectors=iostat", defaultCollectors)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer removeTarget(target)
+
+  _,output := captureDump(t, target, "prometheus")
+  if !strings.Contains(string(output), `spdk_bytes_read{bdev_name="Nvme0n1",target="dump"} 4096`) {
+    t.Errorf("runDump printed %q, expected the bytes read of Nvme0n1", output)
+  }
+  for _,line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+    name := strings.TrimPrefix(strings.TrimPrefix(line, "# HELP "), "# TYPE ")
+    if !strings.HasPrefix(name, "spdk_") {
+      t.Errorf("runDump printed %q, expected only SPDK metrics", line)
+    }
+  }
+}
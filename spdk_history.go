@@ -0,0 +1,356 @@
+//##############################################################################
+//# spdk_history.go
+//#
+//#
+//# Description:  Recent samples of every target.  The samples pushed to the
+//#               stream are also kept in a ring buffer per target so the
+//#               dashboard can show the last minutes as soon as it is opened
+//#               and /api/v1/range can return data at the collection interval
+//#               after an incident, finer than the Prometheus scrape interval
+//##############################################################################
+
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Number of minutes of samples kept per target, set with -history-minutes
+var historyMinutes = 30
+
+// Ring buffer of the last samples of a target, allocated with the first sample
+type History struct {
+  mutex sync.Mutex
+  size int
+  samples []Sample
+  next int
+  count int
+}
+
+// The samples of a target as returned by /api/v1/history
+type HistoryReport struct {
+  Target string `json:"target"`
+  Interval int `json:"interval"`
+  Size int `json:"size"`
+  Samples []Sample `json:"samples"`
+}
+
+// The values of a metric as returned by /api/v1/range
+type RangePoint struct {
+  Time time.Time `json:"time"`
+  Value float64 `json:"value"`
+}
+
+type RangeSeries struct {
+  Target string `json:"target"`
+  Bdev string `json:"bdev,omitempty"`
+  Values []RangePoint `json:"values"`
+}
+
+type RangeReport struct {
+  Metric string `json:"metric"`
+  Start time.Time `json:"start"`
+  End time.Time `json:"end"`
+  Series []RangeSeries `json:"series"`
+}
+
+// Metrics of the samples that can be queried with /api/v1/range, named after
+// the fields of the samples
+var bdevRangeMetrics = map[string]func(rates BDEV_rates) float64{
+  "read_ops_per_sec": func(rates BDEV_rates) float64 { return rates.Read_ops_per_sec },
+  "write_ops_per_sec": func(rates BDEV_rates) float64 { return rates.Write_ops_per_sec },
+  "unmap_ops_per_sec": func(rates BDEV_rates) float64 { return rates.Unmap_ops_per_sec },
+  "read_bytes_per_sec": func(rates BDEV_rates) float64 { return rates.Read_bytes_per_sec },
+  "write_bytes_per_sec": func(rates BDEV_rates) float64 { return rates.Write_bytes_per_sec },
+  "unmap_bytes_per_sec": func(rates BDEV_rates) float64 { return rates.Unmap_bytes_per_sec },
+  "read_latency_us": func(rates BDEV_rates) float64 { return rates.Read_latency_us },
+  "write_latency_us": func(rates BDEV_rates) float64 { return rates.Write_latency_us },
+}
+
+var ocfRangeMetrics = map[string]func(ocf *OCF_sample) float64{
+  "hit_ratio": func(ocf *OCF_sample) float64 { return ocf.Hit_ratio },
+  "read_hits": func(ocf *OCF_sample) float64 { return ocf.Read_hits },
+  "read_partial_misses": func(ocf *OCF_sample) float64 { return ocf.Read_partial_misses },
+  "read_full_misses": func(ocf *OCF_sample) float64 { return ocf.Read_full_misses },
+  "write_hits": func(ocf *OCF_sample) float64 { return ocf.Write_hits },
+  "write_partial_misses": func(ocf *OCF_sample) float64 { return ocf.Write_partial_misses },
+  "write_full_misses": func(ocf *OCF_sample) float64 { return ocf.Write_full_misses },
+  "pass_through": func(ocf *OCF_sample) float64 { return ocf.Pass_through },
+  "occupancy_percent": func(ocf *OCF_sample) float64 { return ocf.Occupancy_percent },
+  "clean_percent": func(ocf *OCF_sample) float64 { return ocf.Clean_percent },
+  "dirty_percent": func(ocf *OCF_sample) float64 { return ocf.Dirty_percent },
+  "free_percent": func(ocf *OCF_sample) float64 { return ocf.Free_percent },
+}
+
+//##############################################################################
+//# Function: historySize
+//#
+//# Input:   interval - the collection interval of the target in seconds
+//# Output:  The number of samples to keep for the target
+//#
+//# Description:  This function converts -history-minutes into a number of
+//#               samples, at least one
+//##############################################################################
+func historySize(interval int) int {
+  if interval < 1 {
+    interval = 1
+  }
+  size := historyMinutes * 60 / interval
+  if size < 1 {
+    size = 1
+  }
+  return size
+}
+
+//##############################################################################
+//# Function: newHistory
+//#
+//# Input:   size - the number of samples to keep
+//# Output:  An empty ring buffer
+//#
+//# Description:  This function creates the history of a target.  The samples
+//#               are only allocated when the first one is added, so targets
+//#               that are never collected in the background cost nothing
+//##############################################################################
+func newHistory(size int) *History {
+  return &History{size: size}
+}
+
+//##############################################################################
+//# Function: addSample
+//#
+//# Input:   history - the history of the target
+//#          sample  - the sample of the last collection
+//# Output:  None
+//#
+//# Description:  This function adds a sample to the history, replacing the
+//#               oldest one when the history is full
+//##############################################################################
+func addSample(history *History, sample Sample) {
+  history.mutex.Lock()
+  defer history.mutex.Unlock()
+
+  if history.size < 1 {
+    return
+  }
+  if history.samples == nil {
+    history.samples = make([]Sample, history.size)
+  }
+  history.samples[history.next] = sample
+  history.next = (history.next + 1) % len(history.samples)
+  if history.count < len(history.samples) {
+    history.count++
+  }
+}
+
+//##############################################################################
+//# Function: historySamples
+//#
+//# Input:   history - the history of the target
+//# Output:  The samples of the history, the oldest first
+//#
+//# Description:  This function copies the samples out of the ring buffer
+//##############################################################################
+func historySamples(history *History) []Sample {
+  history.mutex.Lock()
+  defer history.mutex.Unlock()
+
+  samples := make([]Sample, 0, history.count)
+  start := history.next - history.count
+  if start < 0 {
+    start += len(history.samples)
+  }
+  for i := 0; i < history.count; i++ {
+    samples = append(samples, history.samples[(start + i) % len(history.samples)])
+  }
+  return samples
+}
+
+//##############################################################################
+//# Function: historyHandler
+//#
+//# Input:   w - the HTTP response
+//#          r - the HTTP request.  ?target=NAME returns only this target and
+//#              ?bdev=NAME, which can be repeated, only these bdevs
+//# Output:  None
+//#
+//# Description:  This function serves /api/v1/history, the samples kept for
+//#               every target in the same format as the events of the stream
+//##############################################################################
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+  name := r.URL.Query().Get("target")
+  if name != "" && findTarget(name) == nil {
+    http.Error(w, "unknown target " + name, http.StatusNotFound)
+    return
+  }
+  bdevs := r.URL.Query()["bdev"]
+
+  reports := []HistoryReport{}
+  for _,target := range targets {
+    if name != "" && target.Name != name {
+      continue
+    }
+
+    report := HistoryReport{Target: target.Name, Interval: target.Interval, Size: target.history.size, Samples: []Sample{}}
+    for _,sample := range historySamples(target.history) {
+      report.Samples = append(report.Samples, filterSample(sample, bdevs))
+    }
+    reports = append(reports, report)
+  }
+  writeJSON(w, map[string][]HistoryReport{"targets": reports})
+}
+
+//##############################################################################
+//# Function: parseRangeTime
+//#
+//# Input:   value - the start or end of a range query, a Unix time in
+//#                  seconds, an RFC 3339 time or a duration before now such as
+//#                  -10m
+//#          now   - the time of the query
+//# Output:  The time and an error if the value is invalid
+//#
+//# Description:  This function parses the times of /api/v1/range.  A value
+//#               starting with - is always a duration, -10 without a unit is
+//#               refused rather than read as a time before 1970
+//##############################################################################
+func parseRangeTime(value string, now time.Time) (time.Time, error) {
+  if strings.HasPrefix(value, "-") {
+    duration,err := time.ParseDuration(value)
+    if err != nil {
+      return time.Time{}, err
+    }
+    return now.Add(duration), nil
+  }
+  if seconds,err := strconv.ParseFloat(value, 64); err == nil {
+    return time.Unix(0, int64(seconds * 1e9)), nil
+  }
+  return time.Parse(time.RFC3339, value)
+}
+
+//##############################################################################
+//# Function: rangeMetricNames
+//#
+//# Input:   None
+//# Output:  The metrics that can be queried with /api/v1/range, sorted
+//#
+//# Description:  This function lists the metrics for the error messages
+//##############################################################################
+func rangeMetricNames() []string {
+  var names []string
+  for name := range bdevRangeMetrics {
+    names = append(names, name)
+  }
+  for name := range ocfRangeMetrics {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  return names
+}
+
+//##############################################################################
+//# Function: rangeHandler
+//#
+//# Input:   w - the HTTP response
+//#          r - the HTTP request.  ?metric= is the metric to return, a field of
+//#              the bdev rates or of the OCF sample, ?bdev=NAME, which can be
+//#              repeated, limits a bdev metric to these bdevs, ?target=NAME to
+//#              this target and ?start= and ?end= to this time range, by
+//#              default all the samples kept
+//# Output:  None
+//#
+//# Description:  This function serves /api/v1/range, the values of one metric
+//#               in the history with one series per target, and per bdev for
+//#               the bdev metrics
+//##############################################################################
+func rangeHandler(w http.ResponseWriter, r *http.Request) {
+  var err error
+  query := r.URL.Query()
+  now := time.Now()
+
+  metric := query.Get("metric")
+  bdev_metric,is_bdev := bdevRangeMetrics[metric]
+  ocf_metric,is_ocf := ocfRangeMetrics[metric]
+  if !is_bdev && !is_ocf {
+    http.Error(w, fmt.Sprintf("unknown metric %q, expected one of %s", metric, strings.Join(rangeMetricNames(), ",")), http.StatusBadRequest)
+    return
+  }
+
+  name := query.Get("target")
+  if name != "" && findTarget(name) == nil {
+    http.Error(w, "unknown target " + name, http.StatusNotFound)
+    return
+  }
+  bdevs := query["bdev"]
+
+  report := RangeReport{Metric: metric, Start: now.Add(-time.Duration(historyMinutes) * time.Minute), End: now, Series: []RangeSeries{}}
+  if value := query.Get("start"); value != "" {
+    if report.Start,err = parseRangeTime(value, now); err != nil {
+      http.Error(w, "invalid start " + value, http.StatusBadRequest)
+      return
+    }
+  }
+  if value := query.Get("end"); value != "" {
+    if report.End,err = parseRangeTime(value, now); err != nil {
+      http.Error(w, "invalid end " + value, http.StatusBadRequest)
+      return
+    }
+  }
+  if report.Start.After(report.End) {
+    http.Error(w, "start " + report.Start.Format(time.RFC3339) + " is after end " + report.End.Format(time.RFC3339), http.StatusBadRequest)
+    return
+  }
+
+  for _,target := range targets {
+    if name != "" && target.Name != name {
+      continue
+    }
+
+    var ocf_series *RangeSeries
+    bdev_series := map[string]*RangeSeries{}
+    var bdev_names []string
+    for _,sample := range historySamples(target.history) {
+      if sample.Time.Before(report.Start) || sample.Time.After(report.End) {
+        continue
+      }
+      point := RangePoint{Time: sample.Time}
+
+      if is_ocf {
+        if sample.Ocf == nil {
+          continue
+        }
+        if ocf_series == nil {
+          ocf_series = &RangeSeries{Target: target.Name}
+        }
+        point.Value = ocf_metric(sample.Ocf)
+        ocf_series.Values = append(ocf_series.Values, point)
+        continue
+      }
+
+      for bdev,rates := range filterSample(sample, bdevs).Bdevs {
+        series,ok := bdev_series[bdev]
+        if !ok {
+          series = &RangeSeries{Target: target.Name, Bdev: bdev}
+          bdev_series[bdev] = series
+          bdev_names = append(bdev_names, bdev)
+        }
+        point.Value = bdev_metric(rates)
+        series.Values = append(series.Values, point)
+      }
+    }
+
+    if ocf_series != nil {
+      report.Series = append(report.Series, *ocf_series)
+    }
+    sort.Strings(bdev_names)
+    for _,bdev := range bdev_names {
+      report.Series = append(report.Series, *bdev_series[bdev])
+    }
+  }
+  writeJSON(w, report)
+}
@@ -0,0 +1,117 @@
+//##############################################################################
+//# spdk_history_test.go
+//#
+//#
+//# Description:  Tests of the ring buffer of samples and of /api/v1/range
+//##############################################################################
+
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+//##############################################################################
+//# Function: TestParseRangeTime
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks the formats of the start and end of a
+//#               range query
+//##############################################################################
+func TestParseRangeTime(t *testing.T) {
+  now := time.Date(2024, 5, 2, 10, 20, 0, 0, time.UTC)
+
+  tests := []struct {
+    value string
+    expected time.Time
+    err bool
+  }{
+    {value: "1714645200", expected: time.Date(2024, 5, 2, 10, 20, 0, 0, time.UTC)},
+    {value: "1714645200.5", expected: time.Date(2024, 5, 2, 10, 20, 0, 500000000, time.UTC)},
+    {value: "2024-05-02T10:15:00Z", expected: time.Date(2024, 5, 2, 10, 15, 0, 0, time.UTC)},
+    {value: "-10m", expected: time.Date(2024, 5, 2, 10, 10, 0, 0, time.UTC)},
+    {value: "-1h30m", expected: time.Date(2024, 5, 2, 8, 50, 0, 0, time.UTC)},
+    {value: "-10", err: true},
+    {value: "10m", err: true},
+    {value: "yesterday", err: true},
+  }
+
+  for _,test := range tests {
+    parsed,err := parseRangeTime(test.value, now)
+    if test.err {
+      if err == nil {
+        t.Errorf("parseRangeTime(%q) returned %v, expected an error", test.value, parsed)
+      }
+      continue
+    }
+    if err != nil || !parsed.Equal(test.expected) {
+      t.Errorf("parseRangeTime(%q) returned %v and error %v, expected %v", test.value, parsed, err, test.expected)
+    }
+  }
+}
+
+//##############################################################################
+//# Function: TestHistorySamples
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks that the ring buffer returns the last
+//#               samples, the oldest first, before and after wrapping around
+//##############################################################################
+func TestHistorySamples(t *testing.T) {
+  history := newHistory(3)
+  if samples := historySamples(history); len(samples) != 0 {
+    t.Errorf("an empty history returned %v", samples)
+  }
+
+  start := time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+  for i := 0; i < 5; i++ {
+    addSample(history, Sample{Target: "test", Time: start.Add(time.Duration(i) * time.Second)})
+
+    samples := historySamples(history)
+    expected := i + 1
+    if expected > 3 {
+      expected = 3
+    }
+    if len(samples) != expected {
+      t.Fatalf("after %d samples the history returned %d samples, expected %d", i + 1, len(samples), expected)
+    }
+    for j,sample := range samples {
+      second := i + 1 - expected + j
+      if !sample.Time.Equal(start.Add(time.Duration(second) * time.Second)) {
+        t.Errorf("after %d samples sample %d is at %v, expected second %d", i + 1, j, sample.Time, second)
+      }
+    }
+  }
+}
+
+//##############################################################################
+//# Function: TestRangeHandlerRejects
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks the invalid range queries
+//##############################################################################
+func TestRangeHandlerRejects(t *testing.T) {
+  tests := []string{
+    "metric=unknown",
+    "metric=hit_ratio&start=-10",
+    "metric=hit_ratio&start=-5m&end=-10m",
+    "metric=hit_ratio&start=2024-05-02T10:20:00Z&end=2024-05-02T10:15:00Z",
+  }
+
+  for _,query := range tests {
+    recorder := httptest.NewRecorder()
+    rangeHandler(recorder, httptest.NewRequest("GET", "/api/v1/range?" + query, nil))
+    if recorder.Code != http.StatusBadRequest {
+      t.Errorf("range %q returned %d %q, expected %d", query, recorder.Code, recorder.Body.String(), http.StatusBadRequest)
+    }
+  }
+}
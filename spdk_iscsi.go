@@ -0,0 +1,238 @@
+//##############################################################################
+//# spdk_iscsi.go
+//#
+//#
+//# Description:  Collector for the SPDK iSCSI target.  It uses the SPDK
+//#               iscsi_get_connections, iscsi_get_target_nodes,
+//#               iscsi_get_portal_groups and iscsi_get_stats RPCs to record the
+//#               connections and sessions per target node, the connection
+//#               states and the LUN to bdev mapping
+//##############################################################################
+
+package main
+
+import (
+    "encoding/json"
+    "strconv"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// Definitions of strucs that will be used to parse data
+type ISCSI_connection struct {
+  Id float64
+  Cid float64
+  Tsih float64
+  Lcore_id float64
+  Initiator_addr string
+  Target_addr string
+  Target_node_name string
+}
+
+type ISCSI_lun struct {
+  Lun_id float64
+  Bdev_name string
+}
+
+type ISCSI_pg_ig_map struct {
+  Pg_tag float64
+  Ig_tag float64
+}
+
+type ISCSI_target_node struct {
+  Name string
+  Alias_name string
+  Queue_depth float64
+  Luns []ISCSI_lun
+  Pg_ig_maps []ISCSI_pg_ig_map
+}
+
+type ISCSI_portal struct {
+  Host string
+  Port string
+}
+
+type ISCSI_portal_group struct {
+  Tag float64
+  Portals []ISCSI_portal
+}
+
+type ISCSI_stats struct {
+  Invalid float64
+  Running float64
+  Exiting float64
+  Exited float64
+}
+
+// Definitions of metrics
+var (
+  ISCSI_connections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_iscsi_connections",
+			Help: "Active iSCSI connection from an initiator to a target node, the value is always 1",
+		},
+		[]string{"target", "target_node", "initiator_addr", "tsih", "cid"},
+	)
+  ISCSI_connection_states = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_iscsi_connection_states",
+			Help: "Number of iSCSI connections in each state",
+		},
+		[]string{"target", "state"},
+	)
+  ISCSI_sessions = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_iscsi_sessions",
+			Help: "Number of iSCSI sessions of a target node",
+		},
+		[]string{"target", "target_node"},
+	)
+  ISCSI_target_node_info = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_iscsi_target_node_info",
+			Help: "iSCSI target node information, the value is always 1",
+		},
+		[]string{"target", "target_node", "alias_name"},
+	)
+  ISCSI_target_node_queue_depth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_iscsi_target_node_queue_depth",
+			Help: "Queue depth of the iSCSI target node",
+		},
+		[]string{"target", "target_node"},
+	)
+  ISCSI_target_node_luns = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_iscsi_target_node_luns",
+			Help: "Number of LUNs of the iSCSI target node",
+		},
+		[]string{"target", "target_node"},
+	)
+  ISCSI_lun_info = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_iscsi_lun_info",
+			Help: "iSCSI LUN and its backing bdev, the value is always 1",
+		},
+		[]string{"target", "target_node", "lun_id", "bdev_name"},
+	)
+  ISCSI_portal_info = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_iscsi_portal_info",
+			Help: "iSCSI portal of a portal group, the value is always 1",
+		},
+		[]string{"target", "pg_tag", "host", "port"},
+	)
+)
+
+//##############################################################################
+//# Function: recordIscsiMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if one of the RPC commands failed or returned invalid data
+//#
+//# Description:  This function executes the RPC commands
+//#               iscsi_get_target_nodes, iscsi_get_portal_groups,
+//#               iscsi_get_connections and iscsi_get_stats and records the
+//#               iSCSI metrics.  Sessions are counted as the distinct TSIH
+//#               values of the connections to a target node
+//##############################################################################
+func recordIscsiMetrics(target *Target) error {
+  var target_nodes []ISCSI_target_node
+  var portal_groups []ISCSI_portal_group
+  var connections []ISCSI_connection
+  var stats ISCSI_stats
+
+  nodes_json_data,err := rpcCall(target, "iscsi_get_target_nodes")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(nodes_json_data, &target_nodes); err != nil {
+    return err
+  }
+
+  portal_groups_json_data,err := rpcCall(target, "iscsi_get_portal_groups")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(portal_groups_json_data, &portal_groups); err != nil {
+    return err
+  }
+
+  connections_json_data,err := rpcCall(target, "iscsi_get_connections")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(connections_json_data, &connections); err != nil {
+    return err
+  }
+
+  stats_json_data,err := rpcCall(target, "iscsi_get_stats")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(stats_json_data, &stats); err != nil {
+    return err
+  }
+
+  series := newSeriesSet(target, "iscsi")
+
+  sessions := map[string]map[float64]bool{}
+  for _,node := range target_nodes {
+    setSeries(series, ISCSI_target_node_info, prometheus.Labels{"target":target.Name, "target_node":node.Name, "alias_name":node.Alias_name}, 1)
+    setSeries(series, ISCSI_target_node_queue_depth, prometheus.Labels{"target":target.Name, "target_node":node.Name}, node.Queue_depth)
+    setSeries(series, ISCSI_target_node_luns, prometheus.Labels{"target":target.Name, "target_node":node.Name}, float64(len(node.Luns)))
+    sessions[node.Name] = map[float64]bool{}
+    for _,lun := range node.Luns {
+      setSeries(series, ISCSI_lun_info, prometheus.Labels{"target":target.Name, "target_node":node.Name, "lun_id":strconv.FormatFloat(lun.Lun_id, 'f', -1, 64), "bdev_name":lun.Bdev_name}, 1)
+    }
+  }
+
+  for _,group := range portal_groups {
+    for _,portal := range group.Portals {
+      setSeries(series, ISCSI_portal_info, prometheus.Labels{"target":target.Name, "pg_tag":strconv.FormatFloat(group.Tag, 'f', -1, 64), "host":portal.Host, "port":portal.Port}, 1)
+    }
+  }
+
+  for _,connection := range connections {
+    setSeries(series, ISCSI_connections, prometheus.Labels{"target":target.Name, "target_node":connection.Target_node_name, "initiator_addr":connection.Initiator_addr,
+                                                          "tsih":strconv.FormatFloat(connection.Tsih, 'f', -1, 64), "cid":strconv.FormatFloat(connection.Cid, 'f', -1, 64)}, 1)
+
+    if sessions[connection.Target_node_name] == nil {
+      sessions[connection.Target_node_name] = map[float64]bool{}
+    }
+    sessions[connection.Target_node_name][connection.Tsih] = true
+  }
+  for node,tsihs := range sessions {
+    setSeries(series, ISCSI_sessions, prometheus.Labels{"target":target.Name, "target_node":node}, float64(len(tsihs)))
+  }
+
+  ISCSI_connection_states.With(prometheus.Labels{"target":target.Name, "state":"invalid"}).Set(stats.Invalid)
+  ISCSI_connection_states.With(prometheus.Labels{"target":target.Name, "state":"running"}).Set(stats.Running)
+  ISCSI_connection_states.With(prometheus.Labels{"target":target.Name, "state":"exiting"}).Set(stats.Exiting)
+  ISCSI_connection_states.With(prometheus.Labels{"target":target.Name, "state":"exited"}).Set(stats.Exited)
+
+  deleteStaleSeries(series)
+  return nil
+}
+
+//##############################################################################
+//# Function: init()
+//#
+//# Input:   None
+//# Output:  None
+//#
+//# Description:  This function registers the iSCSI metrics in Prometheus and
+//#               the iscsi collector
+//##############################################################################
+func init() {
+  registerMetric(ISCSI_connections)
+  registerMetric(ISCSI_connection_states)
+  registerMetric(ISCSI_sessions)
+  registerMetric(ISCSI_target_node_info)
+  registerMetric(ISCSI_target_node_queue_depth)
+  registerMetric(ISCSI_target_node_luns)
+  registerMetric(ISCSI_lun_info)
+  registerMetric(ISCSI_portal_info)
+
+  registerCollector("iscsi", "iSCSI target nodes, LUNs, portals, connections, connection states and sessions", recordIscsiMetrics)
+}
@@ -0,0 +1,209 @@
+//##############################################################################
+//# spdk_lvol.go
+//#
+//#
+//# Description:  Collector for the SPDK logical volume stores and logical
+//#               volumes.  It uses the SPDK bdev_lvol_get_lvstores and
+//#               bdev_get_bdevs RPCs to record the capacity of every lvstore and
+//#               the allocation of every lvol
+//##############################################################################
+
+package main
+
+import (
+    "encoding/json"
+    "strconv"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// Definitions of strucs that will be used to parse data
+type LVOL_store struct {
+  Uuid string
+  Name string
+  Base_bdev string
+  Total_data_clusters float64
+  Free_clusters float64
+  Block_size float64
+  Cluster_size float64
+}
+
+type LVOL_driver struct {
+  Lvol_store_uuid string
+  Base_bdev string
+  Thin_provision bool
+  Num_allocated_clusters float64
+  Snapshot bool
+  Clone bool
+  Base_snapshot string
+  Clones []string
+}
+
+// Definitions of metrics
+var (
+  LVOL_store_total_clusters = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_lvol_store_total_clusters",
+			Help: "Number of data clusters of the lvol store",
+		},
+		[]string{"target", "lvstore", "base_bdev"},
+	)
+  LVOL_store_free_clusters = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_lvol_store_free_clusters",
+			Help: "Number of free clusters of the lvol store",
+		},
+		[]string{"target", "lvstore", "base_bdev"},
+	)
+  LVOL_store_cluster_size = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_lvol_store_cluster_size_bytes",
+			Help: "Cluster size of the lvol store in bytes",
+		},
+		[]string{"target", "lvstore", "base_bdev"},
+	)
+  LVOL_store_total_bytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_lvol_store_total_bytes",
+			Help: "Data capacity of the lvol store in bytes",
+		},
+		[]string{"target", "lvstore", "base_bdev"},
+	)
+  LVOL_store_free_bytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_lvol_store_free_bytes",
+			Help: "Free capacity of the lvol store in bytes",
+		},
+		[]string{"target", "lvstore", "base_bdev"},
+	)
+
+  LVOL_info = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_lvol_info",
+			Help: "Logical volume information, the value is always 1",
+		},
+		[]string{"target", "bdev_name", "alias", "lvstore", "thin_provision", "snapshot", "clone", "base_snapshot"},
+	)
+  LVOL_size_bytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_lvol_size_bytes",
+			Help: "Size of the logical volume in bytes",
+		},
+		[]string{"target", "bdev_name", "lvstore"},
+	)
+  LVOL_allocated_clusters = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_lvol_allocated_clusters",
+			Help: "Number of clusters allocated to the logical volume",
+		},
+		[]string{"target", "bdev_name", "lvstore"},
+	)
+  LVOL_allocated_bytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_lvol_allocated_bytes",
+			Help: "Number of bytes allocated to the logical volume",
+		},
+		[]string{"target", "bdev_name", "lvstore"},
+	)
+  LVOL_clones = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_lvol_clones",
+			Help: "Number of clones of the snapshot",
+		},
+		[]string{"target", "bdev_name", "lvstore"},
+	)
+)
+
+//##############################################################################
+//# Function: recordLvolMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if one of the RPC commands failed or returned invalid data
+//#
+//# Description:  This function executes the RPC commands bdev_lvol_get_lvstores
+//#               and bdev_get_bdevs and records the lvol store and lvol metrics.
+//#               Only the bdevs with lvol driver data are recorded
+//##############################################################################
+func recordLvolMetrics(target *Target) error {
+  var lvstores []LVOL_store
+  var bdevs []BDEV_info
+
+  lvstores_json_data,err := rpcCall(target, "bdev_lvol_get_lvstores")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(lvstores_json_data, &lvstores); err != nil {
+    return err
+  }
+
+  bdevs_json_data,err := rpcCall(target, "bdev_get_bdevs")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(bdevs_json_data, &bdevs); err != nil {
+    return err
+  }
+
+  series := newSeriesSet(target, "lvol")
+
+  lvstore_by_uuid := map[string]LVOL_store{}
+  for _,lvstore := range lvstores {
+    lvstore_by_uuid[lvstore.Uuid] = lvstore
+
+    labels := prometheus.Labels{"target":target.Name, "lvstore":lvstore.Name, "base_bdev":lvstore.Base_bdev}
+    setSeries(series, LVOL_store_total_clusters, labels, lvstore.Total_data_clusters)
+    setSeries(series, LVOL_store_free_clusters, labels, lvstore.Free_clusters)
+    setSeries(series, LVOL_store_cluster_size, labels, lvstore.Cluster_size)
+    setSeries(series, LVOL_store_total_bytes, labels, lvstore.Total_data_clusters * lvstore.Cluster_size)
+    setSeries(series, LVOL_store_free_bytes, labels, lvstore.Free_clusters * lvstore.Cluster_size)
+  }
+
+  for _,bdev := range bdevs {
+    lvol := bdev.Driver_specific.Lvol
+    if lvol == nil {
+      continue
+    }
+    lvstore := lvstore_by_uuid[lvol.Lvol_store_uuid]
+
+    alias := ""
+    if len(bdev.Aliases) > 0 {
+      alias = bdev.Aliases[0]
+    }
+    setSeries(series, LVOL_info, prometheus.Labels{"target":target.Name, "bdev_name":bdev.Name, "alias":alias, "lvstore":lvstore.Name, "thin_provision":strconv.FormatBool(lvol.Thin_provision),
+                                                   "snapshot":strconv.FormatBool(lvol.Snapshot), "clone":strconv.FormatBool(lvol.Clone), "base_snapshot":lvol.Base_snapshot}, 1)
+
+    labels := prometheus.Labels{"target":target.Name, "bdev_name":bdev.Name, "lvstore":lvstore.Name}
+    setSeries(series, LVOL_size_bytes, labels, bdev.Num_blocks * bdev.Block_size)
+    setSeries(series, LVOL_allocated_clusters, labels, lvol.Num_allocated_clusters)
+    setSeries(series, LVOL_allocated_bytes, labels, lvol.Num_allocated_clusters * lvstore.Cluster_size)
+    if lvol.Snapshot {
+      setSeries(series, LVOL_clones, labels, float64(len(lvol.Clones)))
+    }
+  }
+  deleteStaleSeries(series)
+  return nil
+}
+
+//##############################################################################
+//# Function: init()
+//#
+//# Input:   None
+//# Output:  None
+//#
+//# Description:  This function registers the lvol metrics in Prometheus and the
+//#               lvol collector
+//##############################################################################
+func init() {
+  registerMetric(LVOL_store_total_clusters)
+  registerMetric(LVOL_store_free_clusters)
+  registerMetric(LVOL_store_cluster_size)
+  registerMetric(LVOL_store_total_bytes)
+  registerMetric(LVOL_store_free_bytes)
+  registerMetric(LVOL_info)
+  registerMetric(LVOL_size_bytes)
+  registerMetric(LVOL_allocated_clusters)
+  registerMetric(LVOL_allocated_bytes)
+  registerMetric(LVOL_clones)
+
+  registerCollector("lvol", "Logical volume store capacity and logical volume allocation (bdev_lvol_get_lvstores, bdev_get_bdevs)", recordLvolMetrics)
+}
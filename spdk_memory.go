@@ -0,0 +1,458 @@
+//##############################################################################
+//# spdk_memory.go
+//#
+//#
+//# Description:  Collectors for the memory used by SPDK.  The dpdk_mem
+//#               collector uses the SPDK env_dpdk_get_mem_stats RPC, which
+//#               writes a dump of the DPDK heaps, memzones and mempools to a
+//#               file, and parses that file.  The hugepages collector reads the
+//#               hugepage totals of the host from /proc/meminfo and
+//#               /sys/kernel/mm/hugepages
+//##############################################################################
+
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// Definitions of strucs that will be used to parse data
+type DPDKMemStat struct {
+  Filename string
+}
+
+type DPDK_heap struct {
+  Id string
+  Name string
+  Heap_size float64
+  Free_size float64
+  Alloc_size float64
+  Greatest_free_size float64
+  Alloc_count float64
+  Free_count float64
+}
+
+type DPDK_memzone struct {
+  Name string
+  Len float64
+  Socket_id string
+}
+
+type DPDK_mempool struct {
+  Name string
+  Socket_id string
+  Size float64
+  Populated_size float64
+  Total_obj_size float64
+  Common_pool_count float64
+  Total_cache_count float64
+}
+
+type DPDKMemDump struct {
+  Heaps []DPDK_heap
+  Memzones []DPDK_memzone
+  Mempools []DPDK_mempool
+}
+
+// Location of the host memory information
+var (
+  meminfoPath = "/proc/meminfo"
+  hugepagesPath = "/sys/kernel/mm/hugepages"
+)
+
+// Definitions of metrics
+var (
+  DPDK_heap_size = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_dpdk_heap_size_bytes",
+			Help: "Size of the DPDK malloc heap in bytes",
+		},
+		[]string{"target", "heap_id", "heap_name"},
+	)
+  DPDK_heap_free = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_dpdk_heap_free_bytes",
+			Help: "Free memory of the DPDK malloc heap in bytes",
+		},
+		[]string{"target", "heap_id", "heap_name"},
+	)
+  DPDK_heap_alloc = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_dpdk_heap_allocated_bytes",
+			Help: "Allocated memory of the DPDK malloc heap in bytes",
+		},
+		[]string{"target", "heap_id", "heap_name"},
+	)
+  DPDK_heap_greatest_free = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_dpdk_heap_greatest_free_bytes",
+			Help: "Largest free block of the DPDK malloc heap in bytes",
+		},
+		[]string{"target", "heap_id", "heap_name"},
+	)
+  DPDK_heap_alloc_count = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_dpdk_heap_allocations",
+			Help: "Number of allocated blocks of the DPDK malloc heap",
+		},
+		[]string{"target", "heap_id", "heap_name"},
+	)
+  DPDK_heap_free_count = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_dpdk_heap_free_blocks",
+			Help: "Number of free blocks of the DPDK malloc heap",
+		},
+		[]string{"target", "heap_id", "heap_name"},
+	)
+  DPDK_memzones = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_dpdk_memzones",
+			Help: "Number of DPDK memzones",
+		},
+		[]string{"target", "socket_id"},
+	)
+  DPDK_memzone_bytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_dpdk_memzone_bytes",
+			Help: "Memory reserved by the DPDK memzones in bytes",
+		},
+		[]string{"target", "socket_id"},
+	)
+  DPDK_mempool_size = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_dpdk_mempool_size",
+			Help: "Number of elements of the DPDK mempool",
+		},
+		[]string{"target", "mempool", "socket_id"},
+	)
+  DPDK_mempool_available = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_dpdk_mempool_available",
+			Help: "Number of free elements of the DPDK mempool, including the per core caches",
+		},
+		[]string{"target", "mempool", "socket_id"},
+	)
+  DPDK_mempool_bytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_dpdk_mempool_bytes",
+			Help: "Memory used by the populated elements of the DPDK mempool in bytes",
+		},
+		[]string{"target", "mempool", "socket_id"},
+	)
+
+  HUGEPAGES_total = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_hugepages_total",
+			Help: "Number of hugepages of this size on the host",
+		},
+		[]string{"size_kb"},
+	)
+  HUGEPAGES_free = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_hugepages_free",
+			Help: "Number of free hugepages of this size on the host",
+		},
+		[]string{"size_kb"},
+	)
+  HUGEPAGES_reserved = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_hugepages_reserved",
+			Help: "Number of reserved hugepages of this size on the host",
+		},
+		[]string{"size_kb"},
+	)
+  HUGEPAGES_surplus = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_hugepages_surplus",
+			Help: "Number of surplus hugepages of this size on the host",
+		},
+		[]string{"size_kb"},
+	)
+  HUGEPAGES_meminfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_meminfo_bytes",
+			Help: "Host memory information from /proc/meminfo in bytes",
+		},
+		[]string{"field"},
+	)
+)
+
+//##############################################################################
+//# Function: parseDpdkMemDump
+//#
+//# Input:   path - the file written by env_dpdk_get_mem_stats
+//# Output:  The heaps, memzones and mempools found in the file
+//#
+//# Description:  This function parses the output of the DPDK functions
+//#               rte_malloc_dump_stats, rte_memzone_dump and
+//#               rte_mempool_list_dump.  Lines that are not recognized are
+//#               skipped so newer DPDK versions can add fields
+//##############################################################################
+func parseDpdkMemDump(path string) (DPDKMemDump, error) {
+  var dump DPDKMemDump
+
+  f,err := os.Open(path)
+  if err != nil {
+    return dump, err
+  }
+  defer f.Close()
+
+  var heap *DPDK_heap
+  var mempool *DPDK_mempool
+  scanner := bufio.NewScanner(f)
+  for scanner.Scan() {
+    line := strings.TrimSpace(scanner.Text())
+
+    switch {
+    case strings.HasPrefix(line, "Heap id:"):
+      dump.Heaps = append(dump.Heaps, DPDK_heap{Id: strings.TrimSpace(strings.TrimPrefix(line, "Heap id:"))})
+      heap = &dump.Heaps[len(dump.Heaps) - 1]
+      mempool = nil
+
+    case strings.HasPrefix(line, "Zone "):
+      // Zone 0: name:<rte_eth_dev_data>, len:0x34900, virt:0x..., socket_id:0, flags:0
+      var zone DPDK_memzone
+      for _,field := range strings.Split(line, ", ") {
+        if i := strings.Index(field, "name:<"); i >= 0 {
+          zone.Name = strings.TrimSuffix(field[i + len("name:<"):], ">")
+        } else if strings.HasPrefix(field, "len:") {
+          if value,err := strconv.ParseInt(strings.TrimPrefix(field, "len:"), 0, 64); err == nil {
+            zone.Len = float64(value)
+          }
+        } else if strings.HasPrefix(field, "socket_id:") {
+          zone.Socket_id = strings.TrimPrefix(field, "socket_id:")
+        }
+      }
+      dump.Memzones = append(dump.Memzones, zone)
+      heap = nil
+      mempool = nil
+
+    case strings.HasPrefix(line, "mempool <"):
+      // mempool <bdev_io_1234>@0x...
+      name := strings.TrimPrefix(line, "mempool <")
+      if i := strings.Index(name, ">"); i >= 0 {
+        name = name[:i]
+      }
+      dump.Mempools = append(dump.Mempools, DPDK_mempool{Name: name})
+      mempool = &dump.Mempools[len(dump.Mempools) - 1]
+      heap = nil
+
+    case heap != nil && strings.Contains(line, ":"):
+      // Heap_size:1073741824,
+      parts := strings.SplitN(strings.TrimSuffix(line, ","), ":", 2)
+      if parts[0] == "Heap name" {
+        heap.Name = parts[1]
+        continue
+      }
+      value,err := strconv.ParseFloat(parts[1], 64)
+      if err != nil {
+        continue
+      }
+      switch parts[0] {
+      case "Heap_size":          heap.Heap_size = value
+      case "Free_size":          heap.Free_size = value
+      case "Alloc_size":         heap.Alloc_size = value
+      case "Greatest_free_size": heap.Greatest_free_size = value
+      case "Alloc_count":        heap.Alloc_count = value
+      case "Free_count":         heap.Free_count = value
+      }
+
+    case mempool != nil && strings.Contains(line, "="):
+      // size=65535
+      parts := strings.SplitN(line, "=", 2)
+      if parts[0] == "socket_id" {
+        mempool.Socket_id = parts[1]
+        continue
+      }
+      value,err := strconv.ParseFloat(parts[1], 64)
+      if err != nil {
+        continue
+      }
+      switch parts[0] {
+      case "size":              mempool.Size = value
+      case "populated_size":    mempool.Populated_size = value
+      case "total_obj_size":    mempool.Total_obj_size = value
+      case "common_pool_count": mempool.Common_pool_count = value
+      case "total_cache_count": mempool.Total_cache_count = value
+      }
+    }
+  }
+  return dump, scanner.Err()
+}
+
+//##############################################################################
+//# Function: recordDpdkMemMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if the RPC command failed or the dump could not be read
+//#
+//# Description:  This function executes the RPC command env_dpdk_get_mem_stats
+//#               and records the heap, memzone and mempool metrics from the file
+//#               it wrote.  The file is written by the SPDK application so
+//#               targets reached over TCP, which may run on another host, are
+//#               skipped
+//##############################################################################
+func recordDpdkMemMetrics(target *Target) error {
+  var parsed_mem_data DPDKMemStat
+
+  if target.Address != "" {
+    return nil
+  }
+
+  mem_json_data,err := rpcCall(target, "env_dpdk_get_mem_stats")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(mem_json_data, &parsed_mem_data); err != nil {
+    return err
+  }
+
+  dump,err := parseDpdkMemDump(parsed_mem_data.Filename)
+  if err != nil {
+    return err
+  }
+
+  series := newSeriesSet(target, "dpdk_mem")
+
+  for _,heap := range dump.Heaps {
+    labels := prometheus.Labels{"target":target.Name, "heap_id":heap.Id, "heap_name":heap.Name}
+    setSeries(series, DPDK_heap_size, labels, heap.Heap_size)
+    setSeries(series, DPDK_heap_free, labels, heap.Free_size)
+    setSeries(series, DPDK_heap_alloc, labels, heap.Alloc_size)
+    setSeries(series, DPDK_heap_greatest_free, labels, heap.Greatest_free_size)
+    setSeries(series, DPDK_heap_alloc_count, labels, heap.Alloc_count)
+    setSeries(series, DPDK_heap_free_count, labels, heap.Free_count)
+  }
+
+  memzones := map[string]float64{}
+  memzone_bytes := map[string]float64{}
+  for _,zone := range dump.Memzones {
+    memzones[zone.Socket_id]++
+    memzone_bytes[zone.Socket_id] += zone.Len
+  }
+  for socket_id,count := range memzones {
+    setSeries(series, DPDK_memzones, prometheus.Labels{"target":target.Name, "socket_id":socket_id}, count)
+    setSeries(series, DPDK_memzone_bytes, prometheus.Labels{"target":target.Name, "socket_id":socket_id}, memzone_bytes[socket_id])
+  }
+
+  for _,mempool := range dump.Mempools {
+    labels := prometheus.Labels{"target":target.Name, "mempool":mempool.Name, "socket_id":mempool.Socket_id}
+    setSeries(series, DPDK_mempool_size, labels, mempool.Size)
+    setSeries(series, DPDK_mempool_available, labels, mempool.Common_pool_count + mempool.Total_cache_count)
+    setSeries(series, DPDK_mempool_bytes, labels, mempool.Populated_size * mempool.Total_obj_size)
+  }
+
+  deleteStaleSeries(series)
+  return nil
+}
+
+//##############################################################################
+//# Function: readHugepageValue
+//#
+//# Input:   dir  - the sysfs directory of one hugepage size
+//#          name - the file to read in that directory
+//# Output:  The number stored in the file and an error if it could not be read
+//#
+//# Description:  This function reads one of the sysfs hugepage counters
+//##############################################################################
+func readHugepageValue(dir string, name string) (float64, error) {
+  data,err := os.ReadFile(filepath.Join(dir, name))
+  if err != nil {
+    return 0, err
+  }
+  return strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+}
+
+//##############################################################################
+//# Function: recordHugepageMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if the host memory information could not be read
+//#
+//# Description:  This function records the hugepage counters of every hugepage
+//#               size found in /sys/kernel/mm/hugepages and the hugepage
+//#               related fields of /proc/meminfo.  They describe the host, not
+//#               the target, so they have no target label and are shared by
+//#               all the local targets.  Targets reached over TCP are skipped
+//##############################################################################
+func recordHugepageMetrics(target *Target) error {
+  if target.Address != "" {
+    return nil
+  }
+
+  dirs,err := filepath.Glob(filepath.Join(hugepagesPath, "hugepages-*kB"))
+  if err != nil {
+    return err
+  }
+
+  for _,dir := range dirs {
+    size := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(dir), "hugepages-"), "kB")
+    labels := prometheus.Labels{"size_kb":size}
+
+    if value,err := readHugepageValue(dir, "nr_hugepages");      err == nil { HUGEPAGES_total.With(labels).Set(value) }
+    if value,err := readHugepageValue(dir, "free_hugepages");    err == nil { HUGEPAGES_free.With(labels).Set(value) }
+    if value,err := readHugepageValue(dir, "resv_hugepages");    err == nil { HUGEPAGES_reserved.With(labels).Set(value) }
+    if value,err := readHugepageValue(dir, "surplus_hugepages"); err == nil { HUGEPAGES_surplus.With(labels).Set(value) }
+  }
+
+  f,err := os.Open(meminfoPath)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  // Hugepagesize:       2048 kB
+  scanner := bufio.NewScanner(f)
+  for scanner.Scan() {
+    fields := strings.Fields(scanner.Text())
+    if len(fields) != 3 || fields[2] != "kB" {
+      continue
+    }
+    name := strings.TrimSuffix(fields[0], ":")
+    switch name {
+    case "MemTotal", "MemAvailable", "Hugepagesize", "Hugetlb":
+      if value,err := strconv.ParseFloat(fields[1], 64); err == nil {
+        HUGEPAGES_meminfo.With(prometheus.Labels{"field":strings.ToLower(name)}).Set(value * 1024)
+      }
+    }
+  }
+  return scanner.Err()
+}
+
+//##############################################################################
+//# Function: init()
+//#
+//# Input:   None
+//# Output:  None
+//#
+//# Description:  This function registers the DPDK memory and hugepage metrics
+//#               in Prometheus and the dpdk_mem and hugepages collectors
+//##############################################################################
+func init() {
+  registerMetric(DPDK_heap_size)
+  registerMetric(DPDK_heap_free)
+  registerMetric(DPDK_heap_alloc)
+  registerMetric(DPDK_heap_greatest_free)
+  registerMetric(DPDK_heap_alloc_count)
+  registerMetric(DPDK_heap_free_count)
+  registerMetric(DPDK_memzones)
+  registerMetric(DPDK_memzone_bytes)
+  registerMetric(DPDK_mempool_size)
+  registerMetric(DPDK_mempool_available)
+  registerMetric(DPDK_mempool_bytes)
+  registerMetric(HUGEPAGES_total)
+  registerMetric(HUGEPAGES_free)
+  registerMetric(HUGEPAGES_reserved)
+  registerMetric(HUGEPAGES_surplus)
+  registerMetric(HUGEPAGES_meminfo)
+
+  registerCollector("dpdk_mem", "DPDK heaps, memzones and mempools (env_dpdk_get_mem_stats)", recordDpdkMemMetrics)
+  registerCollector("hugepages", "Host hugepage totals from /proc/meminfo and /sys/kernel/mm/hugepages", recordHugepageMetrics)
+}
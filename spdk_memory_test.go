@@ -0,0 +1,110 @@
+//##############################################################################
+//# spdk_memory_test.go
+//#
+//#
+//# Description:  Tests of the parser of the DPDK memory dump
+//##############################################################################
+
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+// Extract of a file written by env_dpdk_get_mem_stats
+const testDpdkMemDump = `DPDK memory size 2048
+DPDK memory size 2048 in 1 heap(s)
+Heap id:0
+	Heap name:socket_0
+	Heap_size:2147483648,
+	Free_size:2099523520,
+	Alloc_size:47960128,
+	Greatest_free_size:2099523264,
+	Alloc_count:86,
+	Free_count:2,
+Heap id:1
+	Heap name:socket_1
+	Heap_size:0,
+	Free_size:0,
+	Alloc_size:0,
+	Greatest_free_size:0,
+	Alloc_count:0,
+	Free_count:0,
+DPDK memzones.
+Zone 0: name:<rte_eth_dev_data>, len:0x34900, virt:0x200000297c80, socket_id:0, flags:0
+Zone 1: name:<MP_bdev_io_1234>, len:0x1400000, virt:0x2000002dd980, socket_id:0, flags:0
+DPDK mempools.
+mempool <bdev_io_1234>@0x2000002dd9c0
+  flags=10
+  socket_id=0
+  pool=0x2000002dd7c0
+  iova=0x6dd9c0
+  nb_mem_chunks=1
+  size=65535
+  populated_size=65535
+  header_size=64
+  elt_size=256
+  trailer_size=0
+  total_obj_size=320
+  private_data_size=0
+  ops_index=0
+  ops_name: <ring_mp_mc>
+  avg bytes/object=320.002441
+  internal cache infos:
+    cache_size=256
+    cache_count[0]=0
+    total_cache_count=128
+  common_pool_count=65407
+  no statistics available
+`
+
+//##############################################################################
+//# Function: TestParseDpdkMemDump
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks the heaps, memzones and mempools read
+//#               from a DPDK memory dump
+//##############################################################################
+func TestParseDpdkMemDump(t *testing.T) {
+  path := filepath.Join(t.TempDir(), "spdk_mem_dump.txt")
+  if err := os.WriteFile(path, []byte(testDpdkMemDump), 0644); err != nil {
+    t.Fatal(err)
+  }
+
+  dump,err := parseDpdkMemDump(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  heaps := []DPDK_heap{
+    {Id: "0", Name: "socket_0", Heap_size: 2147483648, Free_size: 2099523520, Alloc_size: 47960128, Greatest_free_size: 2099523264, Alloc_count: 86, Free_count: 2},
+    {Id: "1", Name: "socket_1"},
+  }
+  if !reflect.DeepEqual(dump.Heaps, heaps) {
+    t.Errorf("parseDpdkMemDump returned heaps %+v, expected %+v", dump.Heaps, heaps)
+  }
+
+  memzones := []DPDK_memzone{
+    {Name: "rte_eth_dev_data", Len: 0x34900, Socket_id: "0"},
+    {Name: "MP_bdev_io_1234", Len: 0x1400000, Socket_id: "0"},
+  }
+  if !reflect.DeepEqual(dump.Memzones, memzones) {
+    t.Errorf("parseDpdkMemDump returned memzones %+v, expected %+v", dump.Memzones, memzones)
+  }
+
+  mempools := []DPDK_mempool{
+    {Name: "bdev_io_1234", Socket_id: "0", Size: 65535, Populated_size: 65535, Total_obj_size: 320, Common_pool_count: 65407, Total_cache_count: 128},
+  }
+  if !reflect.DeepEqual(dump.Mempools, mempools) {
+    t.Errorf("parseDpdkMemDump returned mempools %+v, expected %+v", dump.Mempools, mempools)
+  }
+
+  if _,err := parseDpdkMemDump(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+    t.Errorf("parseDpdkMemDump of a missing file returned no error")
+  }
+}
@@ -0,0 +1,320 @@
+//##############################################################################
+//# spdk_nvme_health.go
+//#
+//#
+//# Description:  Collector for the health of the NVMe controllers attached to
+//#               SPDK.  It uses the SPDK bdev_nvme_get_controllers and
+//#               bdev_nvme_get_controller_health_info RPCs to record the SMART
+//#               data and the state of every controller
+//##############################################################################
+
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// Definitions of strucs that will be used to parse data
+type NVME_trid struct {
+  Trtype string
+  Traddr string
+  Subnqn string
+}
+
+type NVME_ctrlr struct {
+  State string
+  Cntlid float64
+  Trid NVME_trid
+}
+
+type NVME_controller struct {
+  Name string
+  Trid NVME_trid
+  Ctrlrs []NVME_ctrlr
+}
+
+type NVME_health struct {
+  Model_number string
+  Serial_number string
+  Firmware_revision string
+  Traddr string
+  Critical_warning float64
+  Temperature_celsius float64
+  Available_spare_percentage float64
+  Available_spare_threshold_percentage float64
+  Percentage_used float64
+  Data_units_read float64
+  Data_units_written float64
+  Host_read_commands float64
+  Host_write_commands float64
+  Controller_busy_time float64
+  Power_cycles float64
+  Power_on_hours float64
+  Unsafe_shutdowns float64
+  Media_errors float64
+  Num_err_log_entries float64
+  Warning_temperature_time_minutes float64
+  Critical_composite_temperature_time_minutes float64
+}
+
+// The states a controller can be reported in by bdev_nvme_get_controllers
+var nvmeControllerStates = []string{"enabled", "resetting", "reconnect_is_delayed", "failed", "disabled", "deleting"}
+
+// The bits of the SMART critical warning field
+var nvmeCriticalWarnings = []string{"available_spare", "temperature", "device_reliability", "read_only", "volatile_memory_backup", "pmr_read_only"}
+
+// Definitions of metrics
+var (
+  NVMEHealth_info = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_controller_info",
+			Help: "NVMe controller information, the value is always 1",
+		},
+		[]string{"target", "controller", "model_number", "serial_number", "firmware_revision", "traddr"},
+	)
+  NVMEHealth_state = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_controller_state",
+			Help: "1 if the NVMe controller is in this state, 0 otherwise",
+		},
+		[]string{"target", "controller", "trtype", "traddr", "state"},
+	)
+  NVMEHealth_critical_warning = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_critical_warning",
+			Help: "1 if the NVMe critical warning bit is set, 0 otherwise",
+		},
+		[]string{"target", "controller", "warning"},
+	)
+  NVMEHealth_temperature = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_temperature_celsius",
+			Help: "Composite temperature of the NVMe controller in degrees Celsius",
+		},
+		[]string{"target", "controller"},
+	)
+  NVMEHealth_available_spare = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_available_spare_percentage",
+			Help: "Remaining spare capacity of the NVMe device in percent",
+		},
+		[]string{"target", "controller"},
+	)
+  NVMEHealth_available_spare_threshold = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_available_spare_threshold_percentage",
+			Help: "Spare capacity threshold of the NVMe device in percent",
+		},
+		[]string{"target", "controller"},
+	)
+  NVMEHealth_percentage_used = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_percentage_used",
+			Help: "Estimate of the NVMe device life used in percent",
+		},
+		[]string{"target", "controller"},
+	)
+  NVMEHealth_data_units_read = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_data_units_read",
+			Help: "Number of 512 byte data units read, in thousands",
+		},
+		[]string{"target", "controller"},
+	)
+  NVMEHealth_data_units_written = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_data_units_written",
+			Help: "Number of 512 byte data units written, in thousands",
+		},
+		[]string{"target", "controller"},
+	)
+  NVMEHealth_host_read_commands = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_host_read_commands",
+			Help: "Number of read commands completed by the NVMe controller",
+		},
+		[]string{"target", "controller"},
+	)
+  NVMEHealth_host_write_commands = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_host_write_commands",
+			Help: "Number of write commands completed by the NVMe controller",
+		},
+		[]string{"target", "controller"},
+	)
+  NVMEHealth_controller_busy_time = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_controller_busy_time_minutes",
+			Help: "Number of minutes the NVMe controller was busy with IO commands",
+		},
+		[]string{"target", "controller"},
+	)
+  NVMEHealth_power_cycles = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_power_cycles",
+			Help: "Number of power cycles of the NVMe device",
+		},
+		[]string{"target", "controller"},
+	)
+  NVMEHealth_power_on_hours = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_power_on_hours",
+			Help: "Number of power on hours of the NVMe device",
+		},
+		[]string{"target", "controller"},
+	)
+  NVMEHealth_unsafe_shutdowns = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_unsafe_shutdowns",
+			Help: "Number of unsafe shutdowns of the NVMe device",
+		},
+		[]string{"target", "controller"},
+	)
+  NVMEHealth_media_errors = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_media_errors",
+			Help: "Number of unrecovered data integrity errors of the NVMe device",
+		},
+		[]string{"target", "controller"},
+	)
+  NVMEHealth_num_err_log_entries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_num_err_log_entries",
+			Help: "Number of error log entries of the NVMe controller",
+		},
+		[]string{"target", "controller"},
+	)
+  NVMEHealth_warning_temperature_time = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_warning_temperature_time_minutes",
+			Help: "Number of minutes the NVMe device was above the warning temperature",
+		},
+		[]string{"target", "controller"},
+	)
+  NVMEHealth_critical_temperature_time = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_critical_temperature_time_minutes",
+			Help: "Number of minutes the NVMe device was above the critical temperature",
+		},
+		[]string{"target", "controller"},
+	)
+)
+
+//##############################################################################
+//# Function: recordNvmeHealthMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if one of the RPC commands failed or returned invalid data
+//#
+//# Description:  This function executes the RPC command bdev_nvme_get_controllers
+//#               and then bdev_nvme_get_controller_health_info for every
+//#               controller.  A controller that cannot report its health (for
+//#               example while resetting) does not stop the other controllers
+//#               from being recorded and all the failures are returned.  The
+//#               series of a detached controller are deleted once every
+//#               controller reported its health
+//##############################################################################
+func recordNvmeHealthMetrics(target *Target) error {
+  var controllers []NVME_controller
+  var errs []error
+
+  controllers_json_data,err := rpcCall(target, "bdev_nvme_get_controllers")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(controllers_json_data, &controllers); err != nil {
+    return err
+  }
+
+  series := newSeriesSet(target, "nvme_health")
+
+  for _,controller := range controllers {
+    // Older SPDK versions report a single path without the ctrlrs list
+    ctrlrs := controller.Ctrlrs
+    if len(ctrlrs) == 0 {
+      ctrlrs = []NVME_ctrlr{{State: "enabled", Trid: controller.Trid}}
+    }
+    for _,ctrlr := range ctrlrs {
+      for _,state := range nvmeControllerStates {
+        setSeries(series, NVMEHealth_state, prometheus.Labels{"target":target.Name, "controller":controller.Name, "trtype":ctrlr.Trid.Trtype, "traddr":ctrlr.Trid.Traddr, "state":state}, boolToFloat(state == ctrlr.State))
+      }
+    }
+
+    var health NVME_health
+    health_json_data,err := rpcCall(target, "bdev_nvme_get_controller_health_info", RPCParam{Name: "name", Flag: "-c", Value: controller.Name})
+    if err == nil {
+      err = json.Unmarshal(health_json_data, &health)
+    }
+    if err != nil {
+      errs = append(errs, fmt.Errorf("controller %s: %v", controller.Name, err))
+      continue
+    }
+
+    labels := prometheus.Labels{"target":target.Name, "controller":controller.Name}
+    setSeries(series, NVMEHealth_info, prometheus.Labels{"target":target.Name, "controller":controller.Name, "model_number":health.Model_number, "serial_number":health.Serial_number,
+                                                         "firmware_revision":health.Firmware_revision, "traddr":health.Traddr}, 1)
+    for bit,warning := range nvmeCriticalWarnings {
+      setSeries(series, NVMEHealth_critical_warning, prometheus.Labels{"target":target.Name, "controller":controller.Name, "warning":warning}, float64((int(health.Critical_warning) >> bit) & 1))
+    }
+    setSeries(series, NVMEHealth_temperature, labels, health.Temperature_celsius)
+    setSeries(series, NVMEHealth_available_spare, labels, health.Available_spare_percentage)
+    setSeries(series, NVMEHealth_available_spare_threshold, labels, health.Available_spare_threshold_percentage)
+    setSeries(series, NVMEHealth_percentage_used, labels, health.Percentage_used)
+    setSeries(series, NVMEHealth_data_units_read, labels, health.Data_units_read)
+    setSeries(series, NVMEHealth_data_units_written, labels, health.Data_units_written)
+    setSeries(series, NVMEHealth_host_read_commands, labels, health.Host_read_commands)
+    setSeries(series, NVMEHealth_host_write_commands, labels, health.Host_write_commands)
+    setSeries(series, NVMEHealth_controller_busy_time, labels, health.Controller_busy_time)
+    setSeries(series, NVMEHealth_power_cycles, labels, health.Power_cycles)
+    setSeries(series, NVMEHealth_power_on_hours, labels, health.Power_on_hours)
+    setSeries(series, NVMEHealth_unsafe_shutdowns, labels, health.Unsafe_shutdowns)
+    setSeries(series, NVMEHealth_media_errors, labels, health.Media_errors)
+    setSeries(series, NVMEHealth_num_err_log_entries, labels, health.Num_err_log_entries)
+    setSeries(series, NVMEHealth_warning_temperature_time, labels, health.Warning_temperature_time_minutes)
+    setSeries(series, NVMEHealth_critical_temperature_time, labels, health.Critical_composite_temperature_time_minutes)
+  }
+
+  // The health of a controller that failed is kept until it succeeds again
+  if len(errs) > 0 {
+    return errors.Join(errs...)
+  }
+  deleteStaleSeries(series)
+  return nil
+}
+
+//##############################################################################
+//# Function: init()
+//#
+//# Input:   None
+//# Output:  None
+//#
+//# Description:  This function registers the NVMe health metrics in Prometheus
+//#               and the nvme_health collector
+//##############################################################################
+func init() {
+  registerMetric(NVMEHealth_info)
+  registerMetric(NVMEHealth_state)
+  registerMetric(NVMEHealth_critical_warning)
+  registerMetric(NVMEHealth_temperature)
+  registerMetric(NVMEHealth_available_spare)
+  registerMetric(NVMEHealth_available_spare_threshold)
+  registerMetric(NVMEHealth_percentage_used)
+  registerMetric(NVMEHealth_data_units_read)
+  registerMetric(NVMEHealth_data_units_written)
+  registerMetric(NVMEHealth_host_read_commands)
+  registerMetric(NVMEHealth_host_write_commands)
+  registerMetric(NVMEHealth_controller_busy_time)
+  registerMetric(NVMEHealth_power_cycles)
+  registerMetric(NVMEHealth_power_on_hours)
+  registerMetric(NVMEHealth_unsafe_shutdowns)
+  registerMetric(NVMEHealth_media_errors)
+  registerMetric(NVMEHealth_num_err_log_entries)
+  registerMetric(NVMEHealth_warning_temperature_time)
+  registerMetric(NVMEHealth_critical_temperature_time)
+
+  registerCollector("nvme_health", "NVMe controller state and SMART health information", recordNvmeHealthMetrics)
+}
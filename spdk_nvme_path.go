@@ -0,0 +1,242 @@
+//##############################################################################
+//# spdk_nvme_path.go
+//#
+//#
+//# Description:  Collector for the bdev_nvme transports and IO paths.  It uses
+//#               the SPDK bdev_nvme_get_transport_statistics and
+//#               bdev_nvme_get_io_paths RPCs so NVMe multipath failover can be
+//#               seen on graphs
+//##############################################################################
+
+package main
+
+import (
+    "encoding/json"
+    "strconv"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// Definitions of strucs that will be used to parse data
+type NVME_transport_device struct {
+  Dev_name string
+  Polls float64
+  Idle_polls float64
+  Completions float64
+  Queued_requests float64
+}
+
+type NVME_transport_stat struct {
+  Trname string
+  Polls float64
+  Idle_polls float64
+  Completions float64
+  Nvme_completions float64
+  Submitted_requests float64
+  Queued_requests float64
+  Devices []NVME_transport_device
+}
+
+type NVME_transport_poll_group struct {
+  Thread string
+  Transports []NVME_transport_stat
+}
+
+type NVMETransportStat struct {
+  Poll_groups []NVME_transport_poll_group
+}
+
+type NVME_io_path_transport struct {
+  Trtype string
+  Traddr string
+  Trsvcid string
+}
+
+type NVME_io_path struct {
+  Bdev_name string
+  Cntlid float64
+  Current bool
+  Connected bool
+  Accessible bool
+  Ana_state string
+  Transport NVME_io_path_transport
+}
+
+type NVME_io_path_poll_group struct {
+  Thread string
+  Io_paths []NVME_io_path
+}
+
+type NVMEIOPaths struct {
+  Poll_groups []NVME_io_path_poll_group
+}
+
+// The ANA states a path can be reported in by bdev_nvme_get_io_paths
+var nvmeAnaStates = []string{"optimized", "non_optimized", "inaccessible", "persistent_loss", "change"}
+
+// Definitions of metrics
+var (
+  NVMEPath_transport_polls = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvme_transport_polls_total",
+			Help: "Number of bdev_nvme transport polls",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+  NVMEPath_transport_idle_polls = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvme_transport_idle_polls_total",
+			Help: "Number of bdev_nvme transport polls that found no completions",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+  NVMEPath_transport_completions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvme_transport_completions_total",
+			Help: "Number of bdev_nvme transport completions",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+  NVMEPath_transport_submitted_requests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvme_transport_submitted_requests_total",
+			Help: "Number of requests submitted to the bdev_nvme transport",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+  NVMEPath_transport_queued_requests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvme_transport_queued_requests_total",
+			Help: "Number of requests queued by the bdev_nvme transport",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+
+  NVMEPath_current = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_io_path_current",
+			Help: "1 if the IO path is the one currently used for IO, 0 otherwise",
+		},
+		[]string{"target", "bdev_name", "poll_group", "cntlid", "trtype", "traddr", "trsvcid"},
+	)
+  NVMEPath_connected = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_io_path_connected",
+			Help: "1 if the IO path is connected, 0 otherwise",
+		},
+		[]string{"target", "bdev_name", "poll_group", "cntlid", "trtype", "traddr", "trsvcid"},
+	)
+  NVMEPath_accessible = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_io_path_accessible",
+			Help: "1 if the IO path is accessible, 0 otherwise",
+		},
+		[]string{"target", "bdev_name", "poll_group", "cntlid", "trtype", "traddr", "trsvcid"},
+	)
+  NVMEPath_ana_state = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvme_io_path_ana_state",
+			Help: "1 if the IO path is in this ANA state, 0 otherwise",
+		},
+		[]string{"target", "bdev_name", "poll_group", "cntlid", "trtype", "traddr", "trsvcid", "ana_state"},
+	)
+)
+
+//##############################################################################
+//# Function: recordNvmePathMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if one of the RPC commands failed or returned invalid data
+//#
+//# Description:  This function executes the RPC commands
+//#               bdev_nvme_get_transport_statistics and bdev_nvme_get_io_paths
+//#               and records the transport and IO path metrics
+//##############################################################################
+func recordNvmePathMetrics(target *Target) error {
+  var parsed_transport_data NVMETransportStat
+  var parsed_path_data NVMEIOPaths
+
+  transport_json_data,err := rpcCall(target, "bdev_nvme_get_transport_statistics")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(transport_json_data, &parsed_transport_data); err != nil {
+    return err
+  }
+
+  for _,group := range parsed_transport_data.Poll_groups {
+    for _,transport := range group.Transports {
+      // RDMA reports its counters per device, PCIe and TCP per poll group
+      devices := transport.Devices
+      if len(devices) == 0 {
+        completions := transport.Completions
+        if completions == 0 {
+          completions = transport.Nvme_completions
+        }
+        devices = []NVME_transport_device{{Polls: transport.Polls, Idle_polls: transport.Idle_polls,
+                                           Completions: completions, Queued_requests: transport.Queued_requests}}
+      }
+      for _,device := range devices {
+        labels := prometheus.Labels{"target":target.Name, "poll_group":group.Thread, "trtype":transport.Trname, "device":device.Dev_name}
+        setCounter(NVMEPath_transport_polls, "spdk_nvme_transport_polls_total", labels, device.Polls)
+        setCounter(NVMEPath_transport_idle_polls, "spdk_nvme_transport_idle_polls_total", labels, device.Idle_polls)
+        setCounter(NVMEPath_transport_completions, "spdk_nvme_transport_completions_total", labels, device.Completions)
+        setCounter(NVMEPath_transport_submitted_requests, "spdk_nvme_transport_submitted_requests_total", labels, transport.Submitted_requests)
+        setCounter(NVMEPath_transport_queued_requests, "spdk_nvme_transport_queued_requests_total", labels, device.Queued_requests)
+      }
+    }
+  }
+
+  path_json_data,err := rpcCall(target, "bdev_nvme_get_io_paths")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(path_json_data, &parsed_path_data); err != nil {
+    return err
+  }
+
+  series := newSeriesSet(target, "nvme_path")
+
+  for _,group := range parsed_path_data.Poll_groups {
+    for _,path := range group.Io_paths {
+      labels := prometheus.Labels{"target":target.Name, "bdev_name":path.Bdev_name, "poll_group":group.Thread, "cntlid":strconv.FormatFloat(path.Cntlid, 'f', -1, 64),
+                                  "trtype":path.Transport.Trtype, "traddr":path.Transport.Traddr, "trsvcid":path.Transport.Trsvcid}
+      setSeries(series, NVMEPath_current, labels, boolToFloat(path.Current))
+      setSeries(series, NVMEPath_connected, labels, boolToFloat(path.Connected))
+      setSeries(series, NVMEPath_accessible, labels, boolToFloat(path.Accessible))
+
+      if path.Ana_state == "" {
+        continue
+      }
+      for _,state := range nvmeAnaStates {
+        labels["ana_state"] = state
+        setSeries(series, NVMEPath_ana_state, labels, boolToFloat(state == path.Ana_state))
+      }
+    }
+  }
+  deleteStaleSeries(series)
+  return nil
+}
+
+//##############################################################################
+//# Function: init()
+//#
+//# Input:   None
+//# Output:  None
+//#
+//# Description:  This function registers the bdev_nvme transport and IO path
+//#               metrics in Prometheus and the nvme_path collector
+//##############################################################################
+func init() {
+  registerMetric(NVMEPath_transport_polls)
+  registerMetric(NVMEPath_transport_idle_polls)
+  registerMetric(NVMEPath_transport_completions)
+  registerMetric(NVMEPath_transport_submitted_requests)
+  registerMetric(NVMEPath_transport_queued_requests)
+  registerMetric(NVMEPath_current)
+  registerMetric(NVMEPath_connected)
+  registerMetric(NVMEPath_accessible)
+  registerMetric(NVMEPath_ana_state)
+
+  registerCollector("nvme_path", "bdev_nvme transport statistics and IO paths (bdev_nvme_get_transport_statistics, bdev_nvme_get_io_paths)", recordNvmePathMetrics)
+}
@@ -0,0 +1,293 @@
+//##############################################################################
+//# spdk_nvmf.go
+//#
+//#
+//# Description:  Collector for the NVMe-oF target statistics returned by the
+//#               SPDK nvmf_get_stats RPC.  Metrics are recorded per poll group
+//#               and per transport
+//##############################################################################
+
+package main
+
+import (
+    "encoding/json"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// Definitions of strucs that will be used to parse data
+type NVMF_rdma_device struct {
+  Name string
+  Polls float64
+  Idle_polls float64
+  Completions float64
+  Requests float64
+  Request_latency float64
+  Pending_free_request float64
+  Pending_rdma_read float64
+  Pending_rdma_write float64
+  Total_send_wrs float64
+  Send_doorbell_updates float64
+  Total_recv_wrs float64
+  Recv_doorbell_updates float64
+}
+
+type NVMF_transport struct {
+  Trtype string
+  Devices []NVMF_rdma_device
+}
+
+type NVMF_poll_group struct {
+  Name string
+  Admin_qpairs float64
+  Io_qpairs float64
+  Current_admin_qpairs float64
+  Current_io_qpairs float64
+  Pending_bdev_io float64
+  Completed_nvme_io float64
+  Transports []json.RawMessage
+}
+
+type NVMFStat struct {
+  Tick_rate float64
+  Poll_groups []NVMF_poll_group
+}
+
+// Definitions of metrics
+var (
+  NVMFStat_admin_qpairs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvmf_admin_qpairs_total",
+			Help: "Number of admin qpairs created on the poll group",
+		},
+		[]string{"target", "poll_group"},
+	)
+  NVMFStat_io_qpairs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvmf_io_qpairs_total",
+			Help: "Number of io qpairs created on the poll group",
+		},
+		[]string{"target", "poll_group"},
+	)
+  NVMFStat_current_admin_qpairs = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_current_admin_qpairs",
+			Help: "Number of admin qpairs currently connected to the poll group",
+		},
+		[]string{"target", "poll_group"},
+	)
+  NVMFStat_current_io_qpairs = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_current_io_qpairs",
+			Help: "Number of io qpairs currently connected to the poll group",
+		},
+		[]string{"target", "poll_group"},
+	)
+  NVMFStat_pending_bdev_io = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_pending_bdev_io",
+			Help: "Number of requests waiting for a bdev io",
+		},
+		[]string{"target", "poll_group"},
+	)
+  NVMFStat_completed_nvme_io = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvmf_completed_nvme_io_total",
+			Help: "Number of completed nvme io requests",
+		},
+		[]string{"target", "poll_group"},
+	)
+
+  NVMFStat_transport = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_transport_stat",
+			Help: "NVMe-oF transport statistic value",
+		},
+		[]string{"target", "poll_group", "trtype", "stat"},
+	)
+
+  NVMFStat_rdma_polls = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvmf_rdma_polls_total",
+			Help: "Number of RDMA device polls",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+  NVMFStat_rdma_idle_polls = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvmf_rdma_idle_polls_total",
+			Help: "Number of RDMA device polls that found no completions",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+  NVMFStat_rdma_completions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvmf_rdma_completions_total",
+			Help: "Number of RDMA completions",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+  NVMFStat_rdma_requests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvmf_rdma_requests_total",
+			Help: "Number of RDMA requests",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+  NVMFStat_rdma_request_latency = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvmf_rdma_request_latency_ticks_total",
+			Help: "Number of RDMA request latency ticks",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+  NVMFStat_rdma_pending_free_request = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_rdma_pending_free_request",
+			Help: "Number of RDMA requests waiting for a free request",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+  NVMFStat_rdma_pending_rdma_read = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_rdma_pending_rdma_read",
+			Help: "Number of RDMA requests waiting for an RDMA read",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+  NVMFStat_rdma_pending_rdma_write = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_rdma_pending_rdma_write",
+			Help: "Number of RDMA requests waiting for an RDMA write",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+  NVMFStat_rdma_total_send_wrs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvmf_rdma_send_wrs_total",
+			Help: "Number of RDMA send work requests",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+  NVMFStat_rdma_send_doorbell_updates = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvmf_rdma_send_doorbell_updates_total",
+			Help: "Number of RDMA send doorbell updates",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+  NVMFStat_rdma_total_recv_wrs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvmf_rdma_recv_wrs_total",
+			Help: "Number of RDMA receive work requests",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+  NVMFStat_rdma_recv_doorbell_updates = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_nvmf_rdma_recv_doorbell_updates_total",
+			Help: "Number of RDMA receive doorbell updates",
+		},
+		[]string{"target", "poll_group", "trtype", "device"},
+	)
+)
+
+//##############################################################################
+//# Function: recordNvmfMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if the RPC command failed or returned invalid data
+//#
+//# Description:  This function executes the RPC command nvmf_get_stats and
+//#               records the poll group and transport metrics.  The totals
+//#               reported by SPDK are exported as counters and the series of
+//#               a poll group, transport or device that went away are deleted
+//##############################################################################
+func recordNvmfMetrics(target *Target) error {
+  var parsed_nvmf_data NVMFStat
+
+  nvmf_json_data,err := rpcCall(target, "nvmf_get_stats")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(nvmf_json_data, &parsed_nvmf_data); err != nil {
+    return err
+  }
+
+  series := newSeriesSet(target, "nvmf")
+  for _,group := range parsed_nvmf_data.Poll_groups {
+    labels := prometheus.Labels{"target":target.Name, "poll_group":group.Name}
+    setSeriesCounter(series, NVMFStat_admin_qpairs, "spdk_nvmf_admin_qpairs_total", labels, group.Admin_qpairs)
+    setSeriesCounter(series, NVMFStat_io_qpairs, "spdk_nvmf_io_qpairs_total", labels, group.Io_qpairs)
+    setSeries(series, NVMFStat_current_admin_qpairs, labels, group.Current_admin_qpairs)
+    setSeries(series, NVMFStat_current_io_qpairs, labels, group.Current_io_qpairs)
+    setSeries(series, NVMFStat_pending_bdev_io, labels, group.Pending_bdev_io)
+    setSeriesCounter(series, NVMFStat_completed_nvme_io, "spdk_nvmf_completed_nvme_io_total", labels, group.Completed_nvme_io)
+
+    for _,transport_json_data := range group.Transports {
+      var transport NVMF_transport
+      var transport_stats map[string]interface{}
+      json.Unmarshal(transport_json_data, &transport)
+      json.Unmarshal(transport_json_data, &transport_stats)
+
+      // Every numeric field of the transport (TCP socket stats, pending data
+      // buffers, ...) is recorded as is since they differ between transports
+      for stat,value := range transport_stats {
+        if s,ok := value.(float64); ok {
+          setSeries(series, NVMFStat_transport, prometheus.Labels{"target":target.Name, "poll_group":group.Name, "trtype":transport.Trtype, "stat":stat}, s)
+        }
+      }
+
+      for _,device := range transport.Devices {
+        labels := prometheus.Labels{"target":target.Name, "poll_group":group.Name, "trtype":transport.Trtype, "device":device.Name}
+        setSeriesCounter(series, NVMFStat_rdma_polls, "spdk_nvmf_rdma_polls_total", labels, device.Polls)
+        setSeriesCounter(series, NVMFStat_rdma_idle_polls, "spdk_nvmf_rdma_idle_polls_total", labels, device.Idle_polls)
+        setSeriesCounter(series, NVMFStat_rdma_completions, "spdk_nvmf_rdma_completions_total", labels, device.Completions)
+        setSeriesCounter(series, NVMFStat_rdma_requests, "spdk_nvmf_rdma_requests_total", labels, device.Requests)
+        setSeriesCounter(series, NVMFStat_rdma_request_latency, "spdk_nvmf_rdma_request_latency_ticks_total", labels, device.Request_latency)
+        setSeries(series, NVMFStat_rdma_pending_free_request, labels, device.Pending_free_request)
+        setSeries(series, NVMFStat_rdma_pending_rdma_read, labels, device.Pending_rdma_read)
+        setSeries(series, NVMFStat_rdma_pending_rdma_write, labels, device.Pending_rdma_write)
+        setSeriesCounter(series, NVMFStat_rdma_total_send_wrs, "spdk_nvmf_rdma_send_wrs_total", labels, device.Total_send_wrs)
+        setSeriesCounter(series, NVMFStat_rdma_send_doorbell_updates, "spdk_nvmf_rdma_send_doorbell_updates_total", labels, device.Send_doorbell_updates)
+        setSeriesCounter(series, NVMFStat_rdma_total_recv_wrs, "spdk_nvmf_rdma_recv_wrs_total", labels, device.Total_recv_wrs)
+        setSeriesCounter(series, NVMFStat_rdma_recv_doorbell_updates, "spdk_nvmf_rdma_recv_doorbell_updates_total", labels, device.Recv_doorbell_updates)
+      }
+    }
+  }
+  deleteStaleSeries(series)
+  return nil
+}
+
+//##############################################################################
+//# Function: init()
+//#
+//# Input:   None
+//# Output:  None
+//#
+//# Description:  This function registers the NVMe-oF metrics in Prometheus and
+//#               the nvmf collector
+//##############################################################################
+func init() {
+  registerMetric(NVMFStat_admin_qpairs)
+  registerMetric(NVMFStat_io_qpairs)
+  registerMetric(NVMFStat_current_admin_qpairs)
+  registerMetric(NVMFStat_current_io_qpairs)
+  registerMetric(NVMFStat_pending_bdev_io)
+  registerMetric(NVMFStat_completed_nvme_io)
+  registerMetric(NVMFStat_transport)
+  registerMetric(NVMFStat_rdma_polls)
+  registerMetric(NVMFStat_rdma_idle_polls)
+  registerMetric(NVMFStat_rdma_completions)
+  registerMetric(NVMFStat_rdma_requests)
+  registerMetric(NVMFStat_rdma_request_latency)
+  registerMetric(NVMFStat_rdma_pending_free_request)
+  registerMetric(NVMFStat_rdma_pending_rdma_read)
+  registerMetric(NVMFStat_rdma_pending_rdma_write)
+  registerMetric(NVMFStat_rdma_total_send_wrs)
+  registerMetric(NVMFStat_rdma_send_doorbell_updates)
+  registerMetric(NVMFStat_rdma_total_recv_wrs)
+  registerMetric(NVMFStat_rdma_recv_doorbell_updates)
+
+  registerCollector("nvmf", "NVMe-oF target poll group and transport statistics (nvmf_get_stats)", recordNvmfMetrics)
+}
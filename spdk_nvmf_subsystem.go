@@ -0,0 +1,279 @@
+//##############################################################################
+//# spdk_nvmf_subsystem.go
+//#
+//#
+//# Description:  Collector for the NVMe-oF subsystem inventory.  It uses the
+//#               SPDK nvmf_get_subsystems, nvmf_subsystem_get_controllers and
+//#               nvmf_subsystem_get_qpairs RPCs to record the namespaces,
+//#               listeners and connected hosts of every subsystem
+//##############################################################################
+
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strconv"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// Definitions of strucs that will be used to parse data
+type NVMF_listen_address struct {
+  Trtype string
+  Transport string
+  Adrfam string
+  Traddr string
+  Trsvcid string
+}
+
+type NVMF_host struct {
+  Nqn string
+}
+
+type NVMF_namespace struct {
+  Nsid float64
+  Bdev_name string
+  Uuid string
+}
+
+type NVMF_subsystem struct {
+  Nqn string
+  Subtype string
+  Serial_number string
+  Model_number string
+  Allow_any_host bool
+  Listen_addresses []NVMF_listen_address
+  Hosts []NVMF_host
+  Namespaces []NVMF_namespace
+}
+
+type NVMF_controller struct {
+  Cntlid float64
+  Hostnqn string
+  Num_io_qpairs float64
+}
+
+type NVMF_qpair struct {
+  Cntlid float64
+  Qid float64
+  State string
+}
+
+// Definitions of metrics
+var (
+  NVMFSubsystem_count = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_subsystems",
+			Help: "Number of NVMe-oF subsystems",
+		},
+		[]string{"target"},
+	)
+  NVMFSubsystem_info = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_subsystem_info",
+			Help: "NVMe-oF subsystem information, the value is always 1",
+		},
+		[]string{"target", "nqn", "subtype", "serial_number", "model_number", "allow_any_host"},
+	)
+  NVMFSubsystem_namespaces = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_subsystem_namespaces",
+			Help: "Number of namespaces in the subsystem",
+		},
+		[]string{"target", "nqn"},
+	)
+  NVMFSubsystem_namespace_info = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_subsystem_namespace_info",
+			Help: "NVMe-oF namespace and its backing bdev, the value is always 1",
+		},
+		[]string{"target", "nqn", "nsid", "bdev_name", "uuid"},
+	)
+  NVMFSubsystem_listeners = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_subsystem_listeners",
+			Help: "Number of listeners of the subsystem",
+		},
+		[]string{"target", "nqn"},
+	)
+  NVMFSubsystem_listener_info = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_subsystem_listener_info",
+			Help: "NVMe-oF subsystem listen address, the value is always 1",
+		},
+		[]string{"target", "nqn", "trtype", "adrfam", "traddr", "trsvcid"},
+	)
+  NVMFSubsystem_controllers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_subsystem_controllers",
+			Help: "Number of controllers connected to the subsystem",
+		},
+		[]string{"target", "nqn"},
+	)
+  NVMFSubsystem_host_connected = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_subsystem_host_connected",
+			Help: "Number of controllers a host has connected to the subsystem, 0 when an allowed host is not connected",
+		},
+		[]string{"target", "nqn", "hostnqn"},
+	)
+  NVMFSubsystem_host_io_qpairs = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_subsystem_host_io_qpairs",
+			Help: "Number of io qpairs a host has connected to the subsystem",
+		},
+		[]string{"target", "nqn", "hostnqn"},
+	)
+  NVMFSubsystem_qpairs = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_nvmf_subsystem_qpairs",
+			Help: "Number of qpairs of the subsystem in each state",
+		},
+		[]string{"target", "nqn", "state"},
+	)
+)
+
+//##############################################################################
+//# Function: recordNvmfSubsystemMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if one of the RPC commands failed or returned invalid data
+//#
+//# Description:  This function executes the RPC command nvmf_get_subsystems
+//#               and then nvmf_subsystem_get_controllers and
+//#               nvmf_subsystem_get_qpairs for every subsystem.  A failure on
+//#               one subsystem does not stop the others and all the failures
+//#               are returned.  Removed subsystems are only dropped once the
+//#               whole collection succeeded, and a host that was connected to
+//#               the subsystem stays at 0 when it disconnects, also for
+//#               subsystems that allow any host
+//##############################################################################
+func recordNvmfSubsystemMetrics(target *Target) error {
+  var subsystems []NVMF_subsystem
+  var errs []error
+
+  subsystems_json_data,err := rpcCall(target, "nvmf_get_subsystems")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(subsystems_json_data, &subsystems); err != nil {
+    return err
+  }
+
+  series := newSeriesSet(target, "nvmf_subsystem")
+  known_hosts := map[string]map[string]bool{}
+
+  NVMFSubsystem_count.With(prometheus.Labels{"target":target.Name}).Set(float64(len(subsystems)))
+  for _,subsystem := range subsystems {
+    setSeries(series, NVMFSubsystem_info, prometheus.Labels{"target":target.Name, "nqn":subsystem.Nqn, "subtype":subsystem.Subtype, "serial_number":subsystem.Serial_number,
+                                                          "model_number":subsystem.Model_number, "allow_any_host":strconv.FormatBool(subsystem.Allow_any_host)}, 1)
+
+    setSeries(series, NVMFSubsystem_namespaces, prometheus.Labels{"target":target.Name, "nqn":subsystem.Nqn}, float64(len(subsystem.Namespaces)))
+    for _,namespace := range subsystem.Namespaces {
+      setSeries(series, NVMFSubsystem_namespace_info, prometheus.Labels{"target":target.Name, "nqn":subsystem.Nqn, "nsid":strconv.FormatFloat(namespace.Nsid, 'f', -1, 64),
+                                                                      "bdev_name":namespace.Bdev_name, "uuid":namespace.Uuid}, 1)
+    }
+
+    setSeries(series, NVMFSubsystem_listeners, prometheus.Labels{"target":target.Name, "nqn":subsystem.Nqn}, float64(len(subsystem.Listen_addresses)))
+    for _,address := range subsystem.Listen_addresses {
+      // Older SPDK versions report the transport type as "transport"
+      trtype := address.Trtype
+      if trtype == "" {
+        trtype = address.Transport
+      }
+      setSeries(series, NVMFSubsystem_listener_info, prometheus.Labels{"target":target.Name, "nqn":subsystem.Nqn, "trtype":trtype, "adrfam":address.Adrfam,
+                                                                     "traddr":address.Traddr, "trsvcid":address.Trsvcid}, 1)
+    }
+
+    // Allowed hosts and the hosts seen before are reported as disconnected
+    // until a controller is found
+    hosts := map[string]bool{}
+    for host := range target.nvmfHosts[subsystem.Nqn] {
+      hosts[host] = true
+    }
+    for _,host := range subsystem.Hosts {
+      hosts[host.Nqn] = true
+    }
+    known_hosts[subsystem.Nqn] = hosts
+
+    var controllers []NVMF_controller
+    controllers_json_data,err := rpcCall(target, "nvmf_subsystem_get_controllers", RPCParam{Name: "nqn", Value: subsystem.Nqn})
+    if err == nil {
+      err = json.Unmarshal(controllers_json_data, &controllers)
+    }
+    if err != nil {
+      errs = append(errs, fmt.Errorf("subsystem %s: %v", subsystem.Nqn, err))
+      continue
+    }
+
+    host_connected := map[string]float64{}
+    host_io_qpairs := map[string]float64{}
+    for host := range hosts {
+      host_connected[host] = 0
+      host_io_qpairs[host] = 0
+    }
+    for _,controller := range controllers {
+      hosts[controller.Hostnqn] = true
+      host_connected[controller.Hostnqn]++
+      host_io_qpairs[controller.Hostnqn] += controller.Num_io_qpairs
+    }
+
+    setSeries(series, NVMFSubsystem_controllers, prometheus.Labels{"target":target.Name, "nqn":subsystem.Nqn}, float64(len(controllers)))
+    for host,connected := range host_connected {
+      setSeries(series, NVMFSubsystem_host_connected, prometheus.Labels{"target":target.Name, "nqn":subsystem.Nqn, "hostnqn":host}, connected)
+      setSeries(series, NVMFSubsystem_host_io_qpairs, prometheus.Labels{"target":target.Name, "nqn":subsystem.Nqn, "hostnqn":host}, host_io_qpairs[host])
+    }
+
+    var qpairs []NVMF_qpair
+    qpairs_json_data,err := rpcCall(target, "nvmf_subsystem_get_qpairs", RPCParam{Name: "nqn", Value: subsystem.Nqn})
+    if err == nil {
+      err = json.Unmarshal(qpairs_json_data, &qpairs)
+    }
+    if err != nil {
+      errs = append(errs, fmt.Errorf("subsystem %s: %v", subsystem.Nqn, err))
+      continue
+    }
+
+    qpair_states := map[string]float64{}
+    for _,qpair := range qpairs {
+      qpair_states[qpair.State]++
+    }
+    for state,count := range qpair_states {
+      setSeries(series, NVMFSubsystem_qpairs, prometheus.Labels{"target":target.Name, "nqn":subsystem.Nqn, "state":state}, count)
+    }
+  }
+
+  // The series of a subsystem that failed are kept until it succeeds again
+  if len(errs) > 0 {
+    return errors.Join(errs...)
+  }
+  target.nvmfHosts = known_hosts
+  deleteStaleSeries(series)
+  return nil
+}
+
+//##############################################################################
+//# Function: init()
+//#
+//# Input:   None
+//# Output:  None
+//#
+//# Description:  This function registers the NVMe-oF subsystem metrics in
+//#               Prometheus and the nvmf_subsystem collector
+//##############################################################################
+func init() {
+  registerMetric(NVMFSubsystem_count)
+  registerMetric(NVMFSubsystem_info)
+  registerMetric(NVMFSubsystem_namespaces)
+  registerMetric(NVMFSubsystem_namespace_info)
+  registerMetric(NVMFSubsystem_listeners)
+  registerMetric(NVMFSubsystem_listener_info)
+  registerMetric(NVMFSubsystem_controllers)
+  registerMetric(NVMFSubsystem_host_connected)
+  registerMetric(NVMFSubsystem_host_io_qpairs)
+  registerMetric(NVMFSubsystem_qpairs)
+
+  registerCollector("nvmf_subsystem", "NVMe-oF subsystems, namespaces, listeners and connected hosts", recordNvmfSubsystemMetrics)
+}
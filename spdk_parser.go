@@ -6,11 +6,20 @@
 //#               OCF data in order to visualize metrics in Grafana
 //#
 //# Usage:     spdk_parser [-port=PORT_NUMBER] | [-cache=OCF_BDEV_NAME] |
+//#                        [-listen-address=ADDRESS:PORT] | [-web.config.file=PATH_TO_WEB_CONFIG] |
 //#                        [-log] | [-logfile=FULL_PATH_TO_LOG]  |
 //#                        [-sleep=SECS_TO_SLEEP_BETWEEN_ITERATIONS] |
-//#                        [-rpc=PATH_TO_SPDK_RPC_CMD]
+//#                        [-rpc=PATH_TO_SPDK_RPC_CMD] | [-ready-intervals=INTERVALS] |
+//#                        [-collectors=COLLECTOR[,COLLECTOR...]] | [-history-minutes=MINUTES] |
+//#                        [-target=name=NAME,socket=RPC_SOCKET|address=HOST:PORT[,interval=SECS][,cache=OCF_BDEV_NAME][,collectors=COLLECTOR[,COLLECTOR...]]]...
 //#
-//#  Example:  spdk_parser -port=2113 -cache=Cache1 -log -logfile="/tmp/spdk_parser.out" --sleep=1
+//#            spdk_parser top [OPTIONS]
+//#            spdk_parser dump [-format=prometheus|json|csv|table] [OPTIONS]
+//#
+//#  Example:  spdk_parser -port=2113 -cache=Cache1 -log -logfile="/tmp/spdk_parser.out" --sleep=1 -collectors=nvmf
+//#            spdk_parser -target=name=nvmf,socket=/var/tmp/nvmf.sock,collectors=iostat,nvmf -target=name=vhost,socket=/var/tmp/vhost.sock,interval=5,collectors=vhost
+//#            spdk_parser top -sleep=2
+//#            spdk_parser dump -format=json -collectors=nvmf
 //##############################################################################
 
 package main
@@ -20,14 +29,15 @@ import (
     "fmt"
     "flag"
     "time"
-    "os/exec"
     "strconv"
     "log"
     "os"
+    "strings"
 
+    "log/slog"
     "net/http"
     "github.com/prometheus/client_golang/prometheus"
-    "github.com/prometheus/client_golang/prometheus/promhttp"
+    "github.com/prometheus/exporter-toolkit/web"
 )
 
 // Global variables
@@ -42,82 +52,120 @@ var (
 
 // Definitions of strucs that will be used to parse data
 type Bdev struct {
+  Name string `json:"name"`
+  Bytes_read float64 `json:"bytes_read"`
+  Num_read_ops float64 `json:"num_read_ops"`
+  Bytes_written float64 `json:"bytes_written"`
+  Num_write_ops float64 `json:"num_write_ops"`
+  Bytes_unmapped float64 `json:"bytes_unmapped"`
+  Num_unmap_os float64 `json:"num_unmap_ops"`
+  Read_latency_ticks float64 `json:"read_latency_ticks"`
+  Write_latency_ticks float64 `json:"write_latency_ticks"`
+  Unmap_latency_ticks float64 `json:"unmap_latency_ticks"`
+}
+
+type BDEV_rate_limits struct {
+  Rw_ios_per_sec float64
+  Rw_mbytes_per_sec float64
+  R_mbytes_per_sec float64
+  W_mbytes_per_sec float64
+}
+
+type BDEV_base struct {
+  Base_bdev string
+  Base_bdev_name string
+}
+
+type BDEV_raid_driver struct {
+  Base_bdevs_list []json.RawMessage
+}
+
+type BDEV_driver_specific struct {
+  Lvol *LVOL_driver
+  Raid *BDEV_raid_driver
+  Split *BDEV_base
+  Passthru *BDEV_base
+  Crypto *BDEV_base
+  Nvme json.RawMessage
+}
+
+type BDEV_info struct {
   Name string
-  Bytes_read float64
-  Num_read_ops float64
-  Bytes_written float64
-  Num_write_ops float64
-  Bytes_unmapped float64
-  Num_unmap_os float64
-  Read_latency_ticks float64
-  Write_latency_ticks float64
-  Unmap_latency_ticks float64
+  Aliases []string
+  Product_name string
+  Block_size float64
+  Num_blocks float64
+  Claimed bool
+  Assigned_rate_limits BDEV_rate_limits
+  Driver_specific BDEV_driver_specific
 }
 
 type TickRate struct {
   Tick_rate float64
+  Ticks float64
 }
 
 type IOStat struct {
-  Tick_rate float64
-  Bdevs []Bdev
+  Tick_rate float64 `json:"tick_rate"`
+  Ticks float64 `json:"ticks"`
+  Bdevs []Bdev `json:"bdevs"`
 }
 
 type OCF_data struct {
-  Count  float64
-  Percentage string
-  Units string
+  Count float64 `json:"count"`
+  Percentage string `json:"percentage"`
+  Units string `json:"units"`
 }
 
 type OCF_usage struct {
-  Occupancy OCF_data
-  Free OCF_data
-  Clean OCF_data
-  Dirty OCF_data
+  Occupancy OCF_data `json:"occupancy"`
+  Free OCF_data `json:"free"`
+  Clean OCF_data `json:"clean"`
+  Dirty OCF_data `json:"dirty"`
 }
 
 type OCF_requests struct {
-  Rd_hits OCF_data
-  Rd_partial_misses OCF_data
-  Rd_full_misses OCF_data
-  Rd_total OCF_data
-  Wr_hits OCF_data
-  Wr_partial_misses OCF_data
-  Wr_full_misses OCF_data
-  Wr_total OCF_data
-  Rd_pt OCF_data
-  Wr_pt OCF_data
-  Serviced OCF_data
-  Total OCF_data
+  Rd_hits OCF_data `json:"rd_hits"`
+  Rd_partial_misses OCF_data `json:"rd_partial_misses"`
+  Rd_full_misses OCF_data `json:"rd_full_misses"`
+  Rd_total OCF_data `json:"rd_total"`
+  Wr_hits OCF_data `json:"wr_hits"`
+  Wr_partial_misses OCF_data `json:"wr_partial_misses"`
+  Wr_full_misses OCF_data `json:"wr_full_misses"`
+  Wr_total OCF_data `json:"wr_total"`
+  Rd_pt OCF_data `json:"rd_pt"`
+  Wr_pt OCF_data `json:"wr_pt"`
+  Serviced OCF_data `json:"serviced"`
+  Total OCF_data `json:"total"`
 }
 
 type OCF_blocks struct {
-  Core_volume_rd OCF_data
-  Core_volume_wr OCF_data
-  Core_volume_total OCF_data
-  Cache_volume_rd OCF_data
-  Cache_volume_wr OCF_data
-  Cache_volume_total OCF_data
-  Volume_rd OCF_data
-  Volume_wr OCF_data
-  Volume_total OCF_data
+  Core_volume_rd OCF_data `json:"core_volume_rd"`
+  Core_volume_wr OCF_data `json:"core_volume_wr"`
+  Core_volume_total OCF_data `json:"core_volume_total"`
+  Cache_volume_rd OCF_data `json:"cache_volume_rd"`
+  Cache_volume_wr OCF_data `json:"cache_volume_wr"`
+  Cache_volume_total OCF_data `json:"cache_volume_total"`
+  Volume_rd OCF_data `json:"volume_rd"`
+  Volume_wr OCF_data `json:"volume_wr"`
+  Volume_total OCF_data `json:"volume_total"`
 }
 
 type OCF_errors struct {
-  Core_volume_rd OCF_data
-  Core_volume_wr OCF_data
-  Core_volume_total OCF_data
-  Cache_volume_rd OCF_data
-  Cache_volume_wr OCF_data
-  Cache_volume_total OCF_data
-  Total OCF_data
+  Core_volume_rd OCF_data `json:"core_volume_rd"`
+  Core_volume_wr OCF_data `json:"core_volume_wr"`
+  Core_volume_total OCF_data `json:"core_volume_total"`
+  Cache_volume_rd OCF_data `json:"cache_volume_rd"`
+  Cache_volume_wr OCF_data `json:"cache_volume_wr"`
+  Cache_volume_total OCF_data `json:"cache_volume_total"`
+  Total OCF_data `json:"total"`
 }
 
 type OCFStat struct {
-  Usage OCF_usage
-  Requests OCF_requests
-  Blocks OCF_blocks
-  Errors OCF_errors
+  Usage OCF_usage `json:"usage"`
+  Requests OCF_requests `json:"requests"`
+  Blocks OCF_blocks `json:"blocks"`
+  Errors OCF_errors `json:"errors"`
 }
 
 // Definitions of metrics
@@ -127,223 +175,256 @@ var (
 			Name: "spdk_bytes_read",
 			Help: "Number of bytes read",
 		},
-		[]string{"bdev_name"},
+		[]string{"target", "bdev_name"},
 	)
   IOStat_read_ops = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "spdk_num_read_ops",
 			Help: "Number of read operations",
 		},
-		[]string{"bdev_name"},
+		[]string{"target", "bdev_name"},
 	)
   IOStat_bytes_written = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "spdk_bytes_written",
 			Help: "Number of bytes written",
 		},
-		[]string{"bdev_name"},
+		[]string{"target", "bdev_name"},
 	)
   IOStat_write_ops = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "spdk_num_write_ops",
 			Help: "Number of write operations",
 		},
-		[]string{"bdev_name"},
+		[]string{"target", "bdev_name"},
 	)
   IOStat_bytes_unmapped = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "spdk_bytes_unmapped",
 			Help: "Number of bytes unmapped",
 		},
-		[]string{"bdev_name"},
+		[]string{"target", "bdev_name"},
 	)
   IOStat_unmapped_ops = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "spdk_unmapped_ops",
 			Help: "Number of unmapped ops",
 		},
-		[]string{"bdev_name"},
+		[]string{"target", "bdev_name"},
 	)
   IOStat_read_latency_ticks = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "spdk_read_latency_ticks",
 			Help: "Number of read latency ticks",
 		},
-		[]string{"bdev_name"},
+		[]string{"target", "bdev_name"},
 	)
   IOStat_write_latency_ticks = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "spdk_write_latency_ticks",
 			Help: "Number of write latency ticks",
 		},
-		[]string{"bdev_name"},
+		[]string{"target", "bdev_name"},
 	)
   IOStat_unmap_latency_ticks = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "spdk_unmap_latency_ticks",
 			Help: "Number of unmap latency ticks",
 		},
-		[]string{"bdev_name"},
+		[]string{"target", "bdev_name"},
 	)
-  IOStat_tick_rate = prometheus.NewCounter(
+  IOStat_tick_rate = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "spdk_tick_rate",
 			Help: "The tick rate",
-	})
+		},
+		[]string{"target"},
+	)
 
   OCFStat_count = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "spdk_ocf_count",
 			Help: "OCF count value",
 		},
-		[]string{"category", "subcategory"},
+		[]string{"target", "category", "subcategory"},
   )
   OCFStat_percentage = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "spdk_ocf_percentage",
 			Help: "OCF percentage value",
 		},
-		[]string{"category", "subcategory"},
+		[]string{"target", "category", "subcategory"},
   )
 )
 
 //##############################################################################
-//# Function: recordMetrics
+//# Function: fetchIostat
 //#
-//# Input:   None
-//# Output:  None
+//# Input:   target - the SPDK application to collect from
+//# Output:  The bdev I/O statistics and an error if the RPC command failed or
+//#          returned invalid data
 //#
-//# Description:  This function will record all the metrics and expose them to
-//#               Prometheus.  It will execute RPC commands get_bdevs_iostat and
-//#               get_ocf_stats
+//# Description:  This function executes the RPC command get_bdevs_iostat and
+//#               parses its result.  Older SPDK versions return an array with
+//#               the tick rate and the bdevs instead of an object, both are
+//#               accepted.  Every collector that needs the bdev I/O statistics
+//#               uses this function
 //##############################################################################
-func recordMetrics() {
-  go func() {
-    for {
-      var parsed_iostat_data IOStat
-
-      io_stat_json_data,iostat_err := exec.Command(rpcCmd,"get_bdevs_iostat").Output()
-
-      xprint("SPDK IOSTAT DATA:\n" + fmt.Sprint(string(io_stat_json_data)))
-      if (iostat_err) != nil {
-        continue
-      }
-
-      json.Unmarshal([]byte(io_stat_json_data), &parsed_iostat_data)
-
-      if (len(parsed_iostat_data.Bdevs) < 1 ){
-        //If unmarshal did not find the bdevs then SPDK is not providing the Bdevs with a key so get it seperately
-        var tick_rates []TickRate
-        json.Unmarshal([]byte(io_stat_json_data), &tick_rates)
-
-        var bdevs []Bdev
-        json.Unmarshal([]byte(io_stat_json_data), &bdevs)
-        parsed_iostat_data.Bdevs = bdevs
-
-        if (len(tick_rates) > 0){
-          parsed_iostat_data.Tick_rate = tick_rates[0].Tick_rate
-        }
-      }
-
-      var parsed_ocf_data OCFStat
-      ocf_json_data,ocf_err := exec.Command(rpcCmd,"get_ocf_stats", cache).Output()
-
-      xprint("SPDK OCF DATA:\n" + fmt.Sprint(string(ocf_json_data)))
-      if (ocf_err) != nil {
-        continue
-      }
-
-      json.Unmarshal([]byte(ocf_json_data), &parsed_ocf_data)
-
-      IOStat_tick_rate.Add(parsed_iostat_data.Tick_rate)
-      for _,bdev := range parsed_iostat_data.Bdevs {
-        IOStat_bytes_read.With(prometheus.Labels{"bdev_name":bdev.Name}).Set(bdev.Bytes_read)
-        IOStat_read_ops.With(prometheus.Labels{"bdev_name":bdev.Name}).Set( bdev.Num_read_ops)
-        IOStat_bytes_written.With(prometheus.Labels{"bdev_name":bdev.Name}).Set( bdev.Bytes_written )
-        IOStat_write_ops.With(prometheus.Labels{"bdev_name":bdev.Name}).Set( bdev.Num_write_ops)
-        IOStat_bytes_unmapped.With(prometheus.Labels{"bdev_name":bdev.Name}).Set(bdev.Bytes_unmapped  )
-        IOStat_unmapped_ops.With(prometheus.Labels{"bdev_name":bdev.Name}).Set(bdev.Num_unmap_os )
-        IOStat_read_latency_ticks.With(prometheus.Labels{"bdev_name":bdev.Name}).Set(bdev.Read_latency_ticks )
-        IOStat_write_latency_ticks.With(prometheus.Labels{"bdev_name":bdev.Name}).Set(bdev.Write_latency_ticks )
-        IOStat_unmap_latency_ticks.With(prometheus.Labels{"bdev_name":bdev.Name}).Set(bdev.Unmap_latency_ticks )
-      }
-
-      OCFStat_count.With(prometheus.Labels{"category":"usage",    "subcategory":"occupancy"}).Set(parsed_ocf_data.Usage.Occupancy.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"usage",    "subcategory":"free"}).Set(parsed_ocf_data.Usage.Free.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"usage",    "subcategory":"clean"}).Set(parsed_ocf_data.Usage.Clean.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"usage",    "subcategory":"dirty"}).Set(parsed_ocf_data.Usage.Dirty.Count)
-
-      OCFStat_count.With(prometheus.Labels{"category":"requests", "subcategory":"rd_hits"}).Set(parsed_ocf_data.Requests.Rd_hits.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"requests", "subcategory":"rd_partial_misses"}).Set(parsed_ocf_data.Requests.Rd_partial_misses.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"requests", "subcategory":"rd_full_misses"}).Set(parsed_ocf_data.Requests.Rd_full_misses.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"requests", "subcategory":"rd_total"}).Set(parsed_ocf_data.Requests.Rd_total.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"requests", "subcategory":"wr_hits"}).Set(parsed_ocf_data.Requests.Wr_hits.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"requests", "subcategory":"wr_partial_misses"}).Set(parsed_ocf_data.Requests.Wr_partial_misses.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"requests", "subcategory":"wr_full_misses"}).Set(parsed_ocf_data.Requests.Wr_full_misses.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"requests", "subcategory":"wr_total"}).Set(parsed_ocf_data.Requests.Wr_total.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"requests", "subcategory":"rd_pt"}).Set(parsed_ocf_data.Requests.Rd_pt.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"requests", "subcategory":"wr_pt"}).Set(parsed_ocf_data.Requests.Wr_pt.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"requests", "subcategory":"serviced"}).Set(parsed_ocf_data.Requests.Serviced.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"requests", "subcategory":"total"}).Set(parsed_ocf_data.Requests.Total.Count)
-
-      OCFStat_count.With(prometheus.Labels{"category":"blocks",   "subcategory":"core_volume_rd"}).Set(parsed_ocf_data.Blocks.Core_volume_rd.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"blocks",   "subcategory":"core_volume_wr"}).Set(parsed_ocf_data.Blocks.Core_volume_wr.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"blocks",   "subcategory":"core_volume_total"}).Set(parsed_ocf_data.Blocks.Core_volume_total.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"blocks",   "subcategory":"cache_volume_rd"}).Set(parsed_ocf_data.Blocks.Cache_volume_rd.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"blocks",   "subcategory":"cache_volume_wr"}).Set(parsed_ocf_data.Blocks.Cache_volume_wr.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"blocks",   "subcategory":"cache_volume_total"}).Set(parsed_ocf_data.Blocks.Cache_volume_total.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"blocks",   "subcategory":"volume_rd"}).Set(parsed_ocf_data.Blocks.Volume_rd.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"blocks",   "subcategory":"volume_wr"}).Set(parsed_ocf_data.Blocks.Volume_wr.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"blocks",   "subcategory":"volume_total"}).Set(parsed_ocf_data.Blocks.Volume_total.Count)
-
-      OCFStat_count.With(prometheus.Labels{"category":"errors",   "subcategory":"core_volume_rd"}).Set(parsed_ocf_data.Errors.Core_volume_rd.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"errors",   "subcategory":"core_volume_wr"}).Set(parsed_ocf_data.Errors.Core_volume_wr.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"errors",   "subcategory":"core_volume_total"}).Set(parsed_ocf_data.Errors.Core_volume_total.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"errors",   "subcategory":"cache_volume_rd"}).Set(parsed_ocf_data.Errors.Cache_volume_rd.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"errors",   "subcategory":"cache_volume_wr"}).Set(parsed_ocf_data.Errors.Cache_volume_wr.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"errors",   "subcategory":"cache_volume_total"}).Set(parsed_ocf_data.Errors.Cache_volume_total.Count)
-      OCFStat_count.With(prometheus.Labels{"category":"errors",   "subcategory":"total"}).Set(parsed_ocf_data.Errors.Total.Count)
-
-
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Usage.Occupancy.Percentage             ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"usage",    "subcategory":"occupancy"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Usage.Free.Percentage                  ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"usage",    "subcategory":"free"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Usage.Clean.Percentage                 ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"usage",    "subcategory":"clean"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Usage.Dirty.Percentage                 ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"usage",    "subcategory":"dirty"}).Set(s)}
-
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Rd_hits.Percentage            ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"requests", "subcategory":"rd_hits"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Rd_partial_misses.Percentage  ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"requests", "subcategory":"rd_partial_misses"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Rd_full_misses.Percentage     ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"requests", "subcategory":"rd_full_misses"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Rd_total.Percentage           ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"requests", "subcategory":"rd_total"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Wr_hits.Percentage            ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"requests", "subcategory":"wr_hits"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Wr_partial_misses.Percentage  ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"requests", "subcategory":"wr_partial_misses"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Wr_full_misses.Percentage     ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"requests", "subcategory":"wr_full_misses"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Wr_total.Percentage           ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"requests", "subcategory":"wr_total"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Rd_pt.Percentage              ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"requests", "subcategory":"rd_pt"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Wr_pt.Percentage              ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"requests", "subcategory":"wr_pt"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Serviced.Percentage           ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"requests", "subcategory":"serviced"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Total.Percentage              ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"requests", "subcategory":"total"}).Set(s)}
-
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Core_volume_rd.Percentage       ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"blocks",   "subcategory":"core_volume_rd"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Core_volume_wr.Percentage       ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"blocks",   "subcategory":"core_volume_wr"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Core_volume_total.Percentage    ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"blocks",   "subcategory":"core_volume_total"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Cache_volume_rd.Percentage      ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"blocks",   "subcategory":"cache_volume_rd"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Cache_volume_wr.Percentage      ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"blocks",   "subcategory":"cache_volume_wr"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Cache_volume_total.Percentage   ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"blocks",   "subcategory":"cache_volume_total"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Volume_rd.Percentage            ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"blocks",   "subcategory":"volume_rd"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Volume_wr.Percentage            ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"blocks",   "subcategory":"volume_wr"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Volume_total.Percentage         ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"blocks",   "subcategory":"volume_total"}).Set(s)}
-
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Errors.Core_volume_rd.Percentage       ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"errors",   "subcategory":"core_volume_rd"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Errors.Core_volume_wr.Percentage       ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"errors",   "subcategory":"core_volume_wr"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Errors.Core_volume_total.Percentage    ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"errors",   "subcategory":"core_volume_total"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Errors.Cache_volume_rd.Percentage      ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"errors",   "subcategory":"cache_volume_rd"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Errors.Cache_volume_wr.Percentage      ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"errors",   "subcategory":"cache_volume_wr"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Errors.Cache_volume_total.Percentage   ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"errors",   "subcategory":"cache_volume_total"}).Set(s)}
-      if s,err := strconv.ParseFloat(parsed_ocf_data.Errors.Total.Percentage                ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"category":"errors",   "subcategory":"total"}).Set(s)}
-
-      time.Sleep(time.Duration(sleepTime) * time.Second)
+func fetchIostat(target *Target) (IOStat, error) {
+  var parsed_iostat_data IOStat
+
+  io_stat_json_data,iostat_err := rpcCall(target, "get_bdevs_iostat")
+  if (iostat_err) != nil {
+    return parsed_iostat_data, iostat_err
+  }
+
+  object_err := json.Unmarshal([]byte(io_stat_json_data), &parsed_iostat_data)
+
+  if (len(parsed_iostat_data.Bdevs) < 1 ){
+    //If unmarshal did not find the bdevs then SPDK is not providing the Bdevs with a key so get it seperately
+    var tick_rates []TickRate
+    json.Unmarshal([]byte(io_stat_json_data), &tick_rates)
+
+    var bdevs []Bdev
+    array_err := json.Unmarshal([]byte(io_stat_json_data), &bdevs)
+    if object_err != nil && array_err != nil {
+      return parsed_iostat_data, object_err
     }
-  }()
+    parsed_iostat_data.Bdevs = bdevs
+
+    if (len(tick_rates) > 0){
+      parsed_iostat_data.Tick_rate = tick_rates[0].Tick_rate
+      parsed_iostat_data.Ticks = tick_rates[0].Ticks
+    }
+  }
+  return parsed_iostat_data, nil
+}
+
+//##############################################################################
+//# Function: recordIostatMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if the RPC command failed
+//#
+//# Description:  This function will record the bdev metrics and expose them to
+//#               Prometheus.  It will execute the RPC command get_bdevs_iostat
+//##############################################################################
+func recordIostatMetrics(target *Target) error {
+  parsed_iostat_data,err := fetchIostat(target)
+  if err != nil {
+    return err
+  }
+
+  storeIostat(target, parsed_iostat_data)
+
+  IOStat_tick_rate.With(prometheus.Labels{"target":target.Name}).Add(parsed_iostat_data.Tick_rate)
+  for _,bdev := range parsed_iostat_data.Bdevs {
+    IOStat_bytes_read.With(prometheus.Labels{"target":target.Name, "bdev_name":bdev.Name}).Set(bdev.Bytes_read)
+    IOStat_read_ops.With(prometheus.Labels{"target":target.Name, "bdev_name":bdev.Name}).Set( bdev.Num_read_ops)
+    IOStat_bytes_written.With(prometheus.Labels{"target":target.Name, "bdev_name":bdev.Name}).Set( bdev.Bytes_written )
+    IOStat_write_ops.With(prometheus.Labels{"target":target.Name, "bdev_name":bdev.Name}).Set( bdev.Num_write_ops)
+    IOStat_bytes_unmapped.With(prometheus.Labels{"target":target.Name, "bdev_name":bdev.Name}).Set(bdev.Bytes_unmapped  )
+    IOStat_unmapped_ops.With(prometheus.Labels{"target":target.Name, "bdev_name":bdev.Name}).Set(bdev.Num_unmap_os )
+    IOStat_read_latency_ticks.With(prometheus.Labels{"target":target.Name, "bdev_name":bdev.Name}).Set(bdev.Read_latency_ticks )
+    IOStat_write_latency_ticks.With(prometheus.Labels{"target":target.Name, "bdev_name":bdev.Name}).Set(bdev.Write_latency_ticks )
+    IOStat_unmap_latency_ticks.With(prometheus.Labels{"target":target.Name, "bdev_name":bdev.Name}).Set(bdev.Unmap_latency_ticks )
+  }
+  return nil
+}
+
+//##############################################################################
+//# Function: recordOcfMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if the RPC command failed
+//#
+//# Description:  This function will record the OCF metrics of the cache bdev of
+//#               the target and expose them to Prometheus.  It will execute the
+//#               RPC command get_ocf_stats
+//##############################################################################
+func recordOcfMetrics(target *Target) error {
+  var parsed_ocf_data OCFStat
+  ocf_json_data,ocf_err := rpcCall(target, "get_ocf_stats", RPCParam{Name: "name", Value: target.Cache})
+  if (ocf_err) != nil {
+    return ocf_err
+  }
+
+  json.Unmarshal([]byte(ocf_json_data), &parsed_ocf_data)
+  storeOcf(target, parsed_ocf_data)
+
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"usage",    "subcategory":"occupancy"}).Set(parsed_ocf_data.Usage.Occupancy.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"usage",    "subcategory":"free"}).Set(parsed_ocf_data.Usage.Free.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"usage",    "subcategory":"clean"}).Set(parsed_ocf_data.Usage.Clean.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"usage",    "subcategory":"dirty"}).Set(parsed_ocf_data.Usage.Dirty.Count)
+
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"rd_hits"}).Set(parsed_ocf_data.Requests.Rd_hits.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"rd_partial_misses"}).Set(parsed_ocf_data.Requests.Rd_partial_misses.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"rd_full_misses"}).Set(parsed_ocf_data.Requests.Rd_full_misses.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"rd_total"}).Set(parsed_ocf_data.Requests.Rd_total.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"wr_hits"}).Set(parsed_ocf_data.Requests.Wr_hits.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"wr_partial_misses"}).Set(parsed_ocf_data.Requests.Wr_partial_misses.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"wr_full_misses"}).Set(parsed_ocf_data.Requests.Wr_full_misses.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"wr_total"}).Set(parsed_ocf_data.Requests.Wr_total.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"rd_pt"}).Set(parsed_ocf_data.Requests.Rd_pt.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"wr_pt"}).Set(parsed_ocf_data.Requests.Wr_pt.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"serviced"}).Set(parsed_ocf_data.Requests.Serviced.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"total"}).Set(parsed_ocf_data.Requests.Total.Count)
+
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"core_volume_rd"}).Set(parsed_ocf_data.Blocks.Core_volume_rd.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"core_volume_wr"}).Set(parsed_ocf_data.Blocks.Core_volume_wr.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"core_volume_total"}).Set(parsed_ocf_data.Blocks.Core_volume_total.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"cache_volume_rd"}).Set(parsed_ocf_data.Blocks.Cache_volume_rd.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"cache_volume_wr"}).Set(parsed_ocf_data.Blocks.Cache_volume_wr.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"cache_volume_total"}).Set(parsed_ocf_data.Blocks.Cache_volume_total.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"volume_rd"}).Set(parsed_ocf_data.Blocks.Volume_rd.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"volume_wr"}).Set(parsed_ocf_data.Blocks.Volume_wr.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"volume_total"}).Set(parsed_ocf_data.Blocks.Volume_total.Count)
+
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"errors",   "subcategory":"core_volume_rd"}).Set(parsed_ocf_data.Errors.Core_volume_rd.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"errors",   "subcategory":"core_volume_wr"}).Set(parsed_ocf_data.Errors.Core_volume_wr.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"errors",   "subcategory":"core_volume_total"}).Set(parsed_ocf_data.Errors.Core_volume_total.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"errors",   "subcategory":"cache_volume_rd"}).Set(parsed_ocf_data.Errors.Cache_volume_rd.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"errors",   "subcategory":"cache_volume_wr"}).Set(parsed_ocf_data.Errors.Cache_volume_wr.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"errors",   "subcategory":"cache_volume_total"}).Set(parsed_ocf_data.Errors.Cache_volume_total.Count)
+  OCFStat_count.With(prometheus.Labels{"target":target.Name, "category":"errors",   "subcategory":"total"}).Set(parsed_ocf_data.Errors.Total.Count)
+
+
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Usage.Occupancy.Percentage             ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"usage",    "subcategory":"occupancy"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Usage.Free.Percentage                  ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"usage",    "subcategory":"free"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Usage.Clean.Percentage                 ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"usage",    "subcategory":"clean"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Usage.Dirty.Percentage                 ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"usage",    "subcategory":"dirty"}).Set(s)}
+
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Rd_hits.Percentage            ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"rd_hits"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Rd_partial_misses.Percentage  ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"rd_partial_misses"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Rd_full_misses.Percentage     ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"rd_full_misses"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Rd_total.Percentage           ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"rd_total"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Wr_hits.Percentage            ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"wr_hits"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Wr_partial_misses.Percentage  ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"wr_partial_misses"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Wr_full_misses.Percentage     ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"wr_full_misses"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Wr_total.Percentage           ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"wr_total"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Rd_pt.Percentage              ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"rd_pt"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Wr_pt.Percentage              ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"wr_pt"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Serviced.Percentage           ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"serviced"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Requests.Total.Percentage              ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"requests", "subcategory":"total"}).Set(s)}
+
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Core_volume_rd.Percentage       ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"core_volume_rd"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Core_volume_wr.Percentage       ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"core_volume_wr"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Core_volume_total.Percentage    ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"core_volume_total"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Cache_volume_rd.Percentage      ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"cache_volume_rd"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Cache_volume_wr.Percentage      ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"cache_volume_wr"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Cache_volume_total.Percentage   ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"cache_volume_total"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Volume_rd.Percentage            ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"volume_rd"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Volume_wr.Percentage            ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"volume_wr"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Blocks.Volume_total.Percentage         ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"blocks",   "subcategory":"volume_total"}).Set(s)}
+
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Errors.Core_volume_rd.Percentage       ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"errors",   "subcategory":"core_volume_rd"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Errors.Core_volume_wr.Percentage       ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"errors",   "subcategory":"core_volume_wr"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Errors.Core_volume_total.Percentage    ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"errors",   "subcategory":"core_volume_total"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Errors.Cache_volume_rd.Percentage      ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"errors",   "subcategory":"cache_volume_rd"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Errors.Cache_volume_wr.Percentage      ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"errors",   "subcategory":"cache_volume_wr"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Errors.Cache_volume_total.Percentage   ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"errors",   "subcategory":"cache_volume_total"}).Set(s)}
+  if s,err := strconv.ParseFloat(parsed_ocf_data.Errors.Total.Percentage                ,64); err == nil { OCFStat_percentage.With(prometheus.Labels{"target":target.Name, "category":"errors",   "subcategory":"total"}).Set(s)}
+  return nil
 }
 
 //##############################################################################
@@ -352,21 +433,25 @@ func recordMetrics() {
 //# Input:   None
 //# Output:  None
 //#
-//# Description:  This function registers all the metrics in Prometheus
+//# Description:  This function registers all the metrics in Prometheus and the
+//#               iostat and ocf collectors
 //##############################################################################
 func init() {
-  prometheus.MustRegister(IOStat_bytes_read)
-  prometheus.MustRegister(IOStat_read_ops)
-  prometheus.MustRegister(IOStat_bytes_written)
-  prometheus.MustRegister(IOStat_write_ops)
-  prometheus.MustRegister(IOStat_bytes_unmapped)
-  prometheus.MustRegister(IOStat_unmapped_ops)
-  prometheus.MustRegister(IOStat_read_latency_ticks)
-  prometheus.MustRegister(IOStat_write_latency_ticks)
-  prometheus.MustRegister(IOStat_unmap_latency_ticks)
-  prometheus.MustRegister(IOStat_tick_rate)
-  prometheus.MustRegister(OCFStat_count)
-  prometheus.MustRegister(OCFStat_percentage)
+  registerMetric(IOStat_bytes_read)
+  registerMetric(IOStat_read_ops)
+  registerMetric(IOStat_bytes_written)
+  registerMetric(IOStat_write_ops)
+  registerMetric(IOStat_bytes_unmapped)
+  registerMetric(IOStat_unmapped_ops)
+  registerMetric(IOStat_read_latency_ticks)
+  registerMetric(IOStat_write_latency_ticks)
+  registerMetric(IOStat_unmap_latency_ticks)
+  registerMetric(IOStat_tick_rate)
+  registerMetric(OCFStat_count)
+  registerMetric(OCFStat_percentage)
+
+  registerCollector("iostat", "bdev I/O statistics (get_bdevs_iostat), enabled by default", recordIostatMetrics)
+  registerCollector("ocf", "OCF statistics of the -cache bdev (get_ocf_stats), enabled by default", recordOcfMetrics)
 }
 
 //##############################################################################
@@ -429,11 +514,28 @@ func main() {
 
   //argument functions, default values, help text
   portPtr := flag.Int("port", 2113, "The port number to provide metrics to")
+  listenPtr := flag.String("listen-address", "", "The address to provide metrics on, for example 127.0.0.1:2113 (default all the interfaces on -port)")
+  webConfigPtr := flag.String("web.config.file", "", "Path to the Prometheus exporter-toolkit web config file that enables TLS or basic authentication")
   sleepPtr := flag.Int("sleep", 1, "The number of seconds to sleep in between metrics")
   logPtr := flag.Bool("log", false, "Turns on logging information")
   logPathPtr := flag.String("logfile", "/tmp/spdk_parser.out", "log file location")
   cacheDevPtr := flag.String("cache", "Cache1", "Cache Bdev Name")
   cmdPtr := flag.String("rpc", "/root/spdk/scripts/rpc.py", "The full path of the SPDK rpc.py script")
+  collectorsPtr := flag.String("collectors", "", "Comma separated list of optional collectors to enable (" + strings.Join(collectorNames(), ",") + ")")
+  readyPtr := flag.Int("ready-intervals", 3, "The number of intervals a target can go without a successful collection before /ready fails")
+  historyPtr := flag.Int("history-minutes", 30, "The number of minutes of samples kept in memory for the dashboard and /api/v1/range")
+  probeTCPPtr := flag.Bool("probe-allow-tcp", false, "Allow /probe to collect from HOST:PORT addresses, only local RPC sockets can be probed otherwise")
+  formatPtr := flag.String("format", "prometheus", "The output format of spdk_parser dump: " + strings.Join(dumpFormats, ", "))
+  var targetSpecs targetFlags
+  flag.Var(&targetSpecs, "target", "SPDK application to scrape, can be repeated: name=NAME,socket=RPC_SOCKET|address=HOST:PORT[,interval=SECS][,cache=OCF_BDEV_NAME][,collectors=COLLECTOR[,COLLECTOR...]]")
+
+  // spdk_parser top shows the targets in the terminal and spdk_parser dump
+  // prints them once instead of serving them
+  command := ""
+  if len(os.Args) > 1 && (os.Args[1] == "top" || os.Args[1] == "dump") {
+    command = os.Args[1]
+    os.Args = append(os.Args[:1], os.Args[2:]...)
+  }
 
   flag.Parse()
 
@@ -443,31 +545,86 @@ func main() {
   logPath = *logPathPtr
   cache = *cacheDevPtr
   rpcCmd = *cmdPtr
+  readyIntervals = *readyPtr
+  historyMinutes = *historyPtr
+  probeAllowTCP = *probeTCPPtr
+  if historyMinutes < 1 {
+    fmt.Println("ERROR: invalid -history-minutes " + strconv.Itoa(historyMinutes) + ", expected at least 1 minute")
+    os.Exit(1)
+  }
 
-  port := ":" + strconv.Itoa(portNumber)
+  var err error
+  targets,err = parseTargets(targetSpecs, *collectorsPtr)
+  if err != nil {
+    fmt.Println("ERROR: " + err.Error())
+    os.Exit(1)
+  }
+
+  listenAddress := ":" + strconv.Itoa(portNumber)
+  if *listenPtr != "" {
+    listenAddress = *listenPtr
+  }
 
   xprint("### Starting Execution of spdk_parser...")
   xprint("Port         :" + strconv.Itoa(portNumber))
+  xprint("Listen Addr  :" + listenAddress)
+  xprint("Web Config   :" + *webConfigPtr)
   xprint("Sleep Time   :" + strconv.Itoa(sleepTime))
   xprint("isLogEnabled :" + strconv.FormatBool(isLogEnabled))
   xprint("Log Path     :" + logPath)
   xprint("Cache Device :" + cache)
   xprint("SPDK RPC Path:" + rpcCmd)
+  for _,target := range targets {
+    xprint("Target       :" + target.Name + " socket=" + target.Socket + " interval=" + strconv.Itoa(target.Interval) +
+           " cache=" + target.Cache + " collectors=" + strings.Join(target.Collectors, ","))
+  }
   xprint("Other Args   :" + fmt.Sprintln(flag.Args()))
 
-  // Test that RPC is working fail if not
-  _,err := exec.Command(rpcCmd,"get_bdevs_iostat").Output()
-  if (err) != nil {
-    fmt.Println("ERROR: Unable to start because the command [" + rpcCmd + " get_bdevs_iostat] FAILED")
-    fmt.Println("ERROR: Please ensure you have installed SPDK and that this command succeeds")
-    fmt.Println("ERROR: The path to the RPC script can be changed with the -rpc=FULL_PATH argument")
-    fmt.Println(err)
-    os.Exit(1)
+  // dump reports the failed RPCs itself, after printing what it collected
+  if command == "dump" {
+    os.Exit(runDump(*formatPtr))
   }
 
-  recordMetrics()
+  // Test that RPC is working on every target fail if not
+  for _,target := range targets {
+    _,err = rpcCall(target, "get_bdevs_iostat")
+    if (err) != nil {
+      fmt.Println("ERROR: Unable to start because the command [" + rpcCmd + " get_bdevs_iostat] FAILED for target " + target.Name)
+      fmt.Println("ERROR: Please ensure you have installed SPDK and that this command succeeds")
+      fmt.Println("ERROR: The path to the RPC script can be changed with the -rpc=FULL_PATH argument")
+      fmt.Println(err)
+      os.Exit(1)
+    }
+  }
 
-  http.Handle("/metrics", promhttp.Handler())
+  if command == "top" {
+    os.Exit(runTop())
+  }
 
-  log.Fatal(http.ListenAndServe(port, nil))
+  for _,target := range targets {
+    recordTargetMetrics(target)
+  }
+
+  http.Handle("/metrics", metricsHandler())
+  http.HandleFunc("/topology", topologyHandler)
+  http.HandleFunc("/probe", probeHandler)
+  http.HandleFunc("/healthz", healthzHandler)
+  http.HandleFunc("/ready", readyHandler)
+  http.HandleFunc("/status", statusHandler)
+  http.HandleFunc("/api/v1/snapshot", snapshotHandler)
+  http.HandleFunc("/api/v1/bdevs/", bdevHandler)
+  http.HandleFunc("/api/v1/stream", streamHandler)
+  http.HandleFunc("/api/v1/history", historyHandler)
+  http.HandleFunc("/api/v1/range", rangeHandler)
+  http.Handle("/", dashboardHandler())
+
+  // The web config file enables TLS and basic authentication on all endpoints
+  systemdSocket := false
+  webConfig := &web.FlagConfig{
+    WebListenAddresses: &[]string{listenAddress},
+    WebSystemdSocket: &systemdSocket,
+    WebConfigFile: webConfigPtr,
+  }
+  logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+  log.Fatal(web.ListenAndServe(&http.Server{}, webConfig, logger))
 }
@@ -0,0 +1,216 @@
+//##############################################################################
+//# spdk_probe.go
+//#
+//#
+//# Description:  The /probe endpoint.  Like the Prometheus blackbox exporter it
+//#               collects the metrics of the SPDK application given in the
+//#               request and returns only these metrics, so the SPDK
+//#               applications to scrape can be chosen with Prometheus relabeling
+//#               instead of -target options
+//##############################################################################
+
+package main
+
+import (
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+    dto "github.com/prometheus/client_model/go"
+)
+
+// Number of probes started, used to give every probe its own target name
+var probeCount uint64
+
+// The target names of the probes running, their series are not served at
+// /metrics
+var probeTargets sync.Map
+
+// Set with -probe-allow-tcp, /probe only collects from local RPC sockets
+// otherwise so it cannot be used to reach other hosts
+var probeAllowTCP bool
+
+//##############################################################################
+//# Function: probeGatherer
+//#
+//# Input:   name  - the target name the probe collected with
+//#          label - the value of the target label returned by the probe
+//#          host  - true to also return the host-wide series
+//# Output:  The gatherer of the series of the probe
+//#
+//# Description:  This function returns the series of the probe from the
+//#               default registry with the target label set to the probed
+//#               socket.  The families are copied so the registry is not
+//#               changed and the series of the other targets are left out
+//##############################################################################
+func probeGatherer(name string, label string, host bool) prometheus.Gatherer {
+  return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+    families,err := prometheus.DefaultGatherer.Gather()
+
+    var filtered []*dto.MetricFamily
+    for _,family := range families {
+      var kept []*dto.Metric
+      for _,metric := range family.GetMetric() {
+        target_name,found := "", false
+        for _,pair := range metric.GetLabel() {
+          if pair.GetName() == "target" {
+            target_name,found = pair.GetValue(),true
+          }
+        }
+        if found && target_name == name {
+          copied := &dto.Metric{Gauge: metric.Gauge, Counter: metric.Counter, Untyped: metric.Untyped, Summary: metric.Summary,
+                                Histogram: metric.Histogram, TimestampMs: metric.TimestampMs}
+          for _,pair := range metric.GetLabel() {
+            if pair.GetName() == "target" {
+              pair = &dto.LabelPair{Name: pair.Name, Value: &label}
+            }
+            copied.Label = append(copied.Label, pair)
+          }
+          kept = append(kept, copied)
+        } else if !found && host && strings.HasPrefix(family.GetName(), "spdk_") {
+          kept = append(kept, metric)
+        }
+      }
+      if len(kept) > 0 {
+        filtered = append(filtered, &dto.MetricFamily{Name: family.Name, Help: family.Help, Type: family.Type, Unit: family.Unit, Metric: kept})
+      }
+    }
+    return filtered, err
+  })
+}
+
+//##############################################################################
+//# Function: metricsHandler
+//#
+//# Input:   None
+//# Output:  The handler of /metrics
+//#
+//# Description:  This function serves the default registry without the series
+//#               of the probes running at the same time
+//##############################################################################
+func metricsHandler() http.Handler {
+  gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+    families,err := prometheus.DefaultGatherer.Gather()
+
+    var filtered []*dto.MetricFamily
+    for _,family := range families {
+      var kept []*dto.Metric
+      for _,metric := range family.GetMetric() {
+        probe := false
+        for _,pair := range metric.GetLabel() {
+          if pair.GetName() == "target" {
+            _,probe = probeTargets.Load(pair.GetValue())
+          }
+        }
+        if !probe {
+          kept = append(kept, metric)
+        }
+      }
+      if len(kept) > 0 {
+        family.Metric = kept
+        filtered = append(filtered, family)
+      }
+    }
+    return filtered, err
+  })
+  return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+}
+
+//##############################################################################
+//# Function: probeHandler
+//#
+//# Input:   w - the HTTP response
+//#          r - the HTTP request.  ?target= is the SPDK application to
+//#              collect from, the path of its RPC socket or the HOST:PORT
+//#              address of its RPC server, ?module=COLLECTOR[,COLLECTOR...]
+//#              the collectors to run (iostat and ocf by default) and
+//#              ?cache=OCF_BDEV_NAME the OCF bdev of the ocf collector
+//# Output:  None
+//#
+//# Description:  This function serves /probe.  It runs the collectors once
+//#               against the RPC socket under a target name of its own, so
+//#               probes of the same socket can run at the same time, returns
+//#               the metrics in Prometheus text format with the socket as
+//#               target label and then removes them.  The probe success and
+//#               duration are kept in a registry of the request
+//##############################################################################
+func probeHandler(w http.ResponseWriter, r *http.Request) {
+  query := r.URL.Query()
+
+  socket := query.Get("target")
+  if socket == "" {
+    http.Error(w, "target parameter is missing", http.StatusBadRequest)
+    return
+  }
+  for _,configured := range targets {
+    if configured.Socket == socket || configured.Address == socket {
+      http.Error(w, "target " + socket + " is already scraped at /metrics as " + configured.Name, http.StatusBadRequest)
+      return
+    }
+  }
+  if !strings.HasPrefix(socket, "/") && !probeAllowTCP {
+    http.Error(w, "target " + socket + " is not an RPC socket path, probing HOST:PORT addresses needs -probe-allow-tcp", http.StatusBadRequest)
+    return
+  }
+
+  name := ""
+  for name == "" || findTarget(name) != nil {
+    name = "probe-" + strconv.FormatUint(atomic.AddUint64(&probeCount, 1), 10)
+  }
+  target := newTarget(name)
+  if strings.HasPrefix(socket, "/") {
+    target.Socket = socket
+  } else {
+    target.Address = socket
+  }
+  if module := query.Get("module"); module != "" {
+    names,err := parseCollectors(module)
+    if err != nil {
+      http.Error(w, err.Error(), http.StatusBadRequest)
+      return
+    }
+    target.Collectors = names
+    target.optional = map[string]bool{}
+  }
+  if cache := query.Get("cache"); cache != "" {
+    target.Cache = cache
+  }
+
+  probeTargets.Store(name, true)
+  defer probeTargets.Delete(name)
+  defer removeTarget(target)
+
+  registry := prometheus.NewRegistry()
+  success := prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "spdk_probe_success",
+			Help: "1 if all the collectors of the probe succeeded, 0 otherwise",
+			ConstLabels: prometheus.Labels{"target":socket},
+		},
+	)
+  duration := prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "spdk_probe_duration_seconds",
+			Help: "Number of seconds the probe took to collect the metrics",
+			ConstLabels: prometheus.Labels{"target":socket},
+		},
+	)
+  registry.MustRegister(success, duration)
+
+  start := time.Now()
+  err := collectTarget(target)
+  success.Set(boolToFloat(err == nil))
+  duration.Set(time.Since(start).Seconds())
+
+  host := false
+  for _,collector := range target.Collectors {
+    host = host || collector == "hugepages"
+  }
+  gatherers := prometheus.Gatherers{registry, probeGatherer(name, socket, host)}
+  promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError}).ServeHTTP(w, r)
+}
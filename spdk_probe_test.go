@@ -0,0 +1,95 @@
+//##############################################################################
+//# spdk_probe_test.go
+//#
+//#
+//# Description:  Tests of the /probe endpoint
+//##############################################################################
+
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+//##############################################################################
+//# Function: TestProbeRejects
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks the probes refused before collecting
+//##############################################################################
+func TestProbeRejects(t *testing.T) {
+  configured := targets
+  defer func() { targets = configured }()
+  target := newTarget("nvmf")
+  target.Socket = "/var/tmp/nvmf.sock"
+  targets = []*Target{target}
+
+  tests := []struct {
+    query string
+    allow_tcp bool
+    err string
+  }{
+    {query: "", err: "target parameter is missing"},
+    {query: "target=/var/tmp/nvmf.sock", err: "already scraped"},
+    {query: "target=10.0.0.2:5260", err: "-probe-allow-tcp"},
+    {query: "target=/var/tmp/spdk2.sock&module=unknown", err: "unknown collector"},
+    {query: "target=10.0.0.2:5260&module=unknown", allow_tcp: true, err: "unknown collector"},
+  }
+
+  defer func() { probeAllowTCP = false }()
+  for _,test := range tests {
+    probeAllowTCP = test.allow_tcp
+    recorder := httptest.NewRecorder()
+    probeHandler(recorder, httptest.NewRequest("GET", "/probe?" + test.query, nil))
+    if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), test.err) {
+      t.Errorf("probe %q returned %d %q, expected %q", test.query, recorder.Code, recorder.Body.String(), test.err)
+    }
+  }
+}
+
+//##############################################################################
+//# Function: TestProbeGatherer
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks that a probe only returns its own series
+//#               with the probed socket as target label and that /metrics
+//#               leaves them out while the probe runs
+//##############################################################################
+func TestProbeGatherer(t *testing.T) {
+  labels := prometheus.Labels{"target":"probe-test", "bdev_name":"Nvme0n1"}
+  other := prometheus.Labels{"target":"nvmf", "bdev_name":"Nvme0n1"}
+  IOStat_bytes_read.With(labels).Set(512)
+  IOStat_bytes_read.With(other).Set(1024)
+  defer IOStat_bytes_read.Delete(labels)
+  defer IOStat_bytes_read.Delete(other)
+
+  families,err := probeGatherer("probe-test", "/var/tmp/spdk2.sock", false).Gather()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(families) != 1 || len(families[0].GetMetric()) != 1 {
+    t.Fatalf("probe returned %v, expected one series", families)
+  }
+  for _,pair := range families[0].GetMetric()[0].GetLabel() {
+    if pair.GetName() == "target" && pair.GetValue() != "/var/tmp/spdk2.sock" {
+      t.Errorf("probe returned target %q, expected the socket", pair.GetValue())
+    }
+  }
+
+  probeTargets.Store("probe-test", true)
+  defer probeTargets.Delete("probe-test")
+  recorder := httptest.NewRecorder()
+  metricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+  if strings.Contains(recorder.Body.String(), "probe-test") || !strings.Contains(recorder.Body.String(), `target="nvmf"`) {
+    t.Errorf("/metrics returned the series of the probe or not the ones of the targets")
+  }
+}
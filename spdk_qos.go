@@ -0,0 +1,136 @@
+//##############################################################################
+//# spdk_qos.go
+//#
+//#
+//# Description:  Collector for the bdev QoS rate limits.  It uses the SPDK
+//#               bdev_get_bdevs RPC to record the limits set with
+//#               bdev_set_qos_limit and get_bdevs_iostat to compare them with
+//#               the rate observed since the previous collection
+//##############################################################################
+
+package main
+
+import (
+    "encoding/json"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// SPDK QoS limits given in MB/s are in units of 1024 * 1024 bytes
+const qosMegabyte = 1024 * 1024
+
+type QOS_sample struct {
+  Time time.Time
+  Bdev Bdev
+}
+
+// Definitions of metrics
+var (
+  QOS_limit = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_bdev_qos_limit",
+			Help: "QoS rate limit assigned to the bdev, 0 when the limit is not set",
+		},
+		[]string{"target", "bdev_name", "limit"},
+	)
+  QOS_utilization = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_bdev_qos_utilization_ratio",
+			Help: "Observed rate of the bdev divided by its QoS rate limit",
+		},
+		[]string{"target", "bdev_name", "limit"},
+	)
+)
+
+//##############################################################################
+//# Function: recordQosMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if one of the RPC commands failed or returned invalid data
+//#
+//# Description:  This function executes the RPC commands bdev_get_bdevs and
+//#               get_bdevs_iostat, records the QoS limits of every bdev and,
+//#               for the limits that are set, the ratio between the rate
+//#               observed since the previous collection and the limit.  A ratio
+//#               close to 1 means the bdev is being throttled
+//##############################################################################
+func recordQosMetrics(target *Target) error {
+  var bdevs []BDEV_info
+
+  bdevs_json_data,err := rpcCall(target, "bdev_get_bdevs")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(bdevs_json_data, &bdevs); err != nil {
+    return err
+  }
+
+  parsed_iostat_data,err := fetchIostat(target)
+  if err != nil {
+    return err
+  }
+  now := time.Now()
+
+  series := newSeriesSet(target, "qos")
+
+  samples := map[string]QOS_sample{}
+  for _,bdev := range parsed_iostat_data.Bdevs {
+    samples[bdev.Name] = QOS_sample{Time: now, Bdev: bdev}
+  }
+
+  for _,bdev := range bdevs {
+    limits := map[string]float64{
+      "rw_ios_per_sec":    bdev.Assigned_rate_limits.Rw_ios_per_sec,
+      "rw_mbytes_per_sec": bdev.Assigned_rate_limits.Rw_mbytes_per_sec,
+      "r_mbytes_per_sec":  bdev.Assigned_rate_limits.R_mbytes_per_sec,
+      "w_mbytes_per_sec":  bdev.Assigned_rate_limits.W_mbytes_per_sec,
+    }
+    for limit,value := range limits {
+      setSeries(series, QOS_limit, prometheus.Labels{"target":target.Name, "bdev_name":bdev.Name, "limit":limit}, value)
+    }
+
+    current,ok := samples[bdev.Name]
+    last,seen := target.qosSamples[bdev.Name]
+    if !ok || !seen {
+      continue
+    }
+    elapsed := current.Time.Sub(last.Time).Seconds()
+    if elapsed <= 0 {
+      continue
+    }
+
+    observed := map[string]float64{
+      "rw_ios_per_sec":    (current.Bdev.Num_read_ops + current.Bdev.Num_write_ops - last.Bdev.Num_read_ops - last.Bdev.Num_write_ops) / elapsed,
+      "rw_mbytes_per_sec": (current.Bdev.Bytes_read + current.Bdev.Bytes_written - last.Bdev.Bytes_read - last.Bdev.Bytes_written) / elapsed / qosMegabyte,
+      "r_mbytes_per_sec":  (current.Bdev.Bytes_read - last.Bdev.Bytes_read) / elapsed / qosMegabyte,
+      "w_mbytes_per_sec":  (current.Bdev.Bytes_written - last.Bdev.Bytes_written) / elapsed / qosMegabyte,
+    }
+    for limit,value := range limits {
+      // Counters going backwards mean the bdev was re-created
+      if value > 0 && observed[limit] >= 0 {
+        setSeries(series, QOS_utilization, prometheus.Labels{"target":target.Name, "bdev_name":bdev.Name, "limit":limit}, observed[limit] / value)
+      }
+    }
+  }
+
+  target.qosSamples = samples
+  deleteStaleSeries(series)
+  return nil
+}
+
+//##############################################################################
+//# Function: init()
+//#
+//# Input:   None
+//# Output:  None
+//#
+//# Description:  This function registers the QoS metrics in Prometheus and the
+//#               qos collector
+//##############################################################################
+func init() {
+  registerMetric(QOS_limit)
+  registerMetric(QOS_utilization)
+
+  registerCollector("qos", "bdev QoS rate limits and utilization (bdev_get_bdevs, get_bdevs_iostat)", recordQosMetrics)
+}
@@ -0,0 +1,175 @@
+//##############################################################################
+//# spdk_raid.go
+//#
+//#
+//# Description:  Collector for the SPDK RAID bdevs.  It uses the SPDK
+//#               bdev_raid_get_bdevs RPC to record the state of every RAID bdev
+//#               and of its base bdevs so a degraded RAID can be alerted on
+//##############################################################################
+
+package main
+
+import (
+    "encoding/json"
+    "strconv"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// Definitions of strucs that will be used to parse data
+type RAID_base_bdev struct {
+  Name string
+  Uuid string
+  Is_configured bool
+}
+
+type RAID_bdev struct {
+  Name string
+  Strip_size_kb float64
+  State string
+  Raid_level string
+  Superblock bool
+  Num_base_bdevs float64
+  Num_base_bdevs_discovered float64
+  Num_base_bdevs_operational float64
+  Base_bdevs_list []json.RawMessage
+}
+
+// The states a RAID bdev can be reported in by bdev_raid_get_bdevs
+var raidStates = []string{"online", "configuring", "offline"}
+
+// Definitions of metrics
+var (
+  RAID_info = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_raid_info",
+			Help: "RAID bdev information, the value is always 1",
+		},
+		[]string{"target", "raid_bdev", "raid_level", "superblock"},
+	)
+  RAID_strip_size_kb = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_raid_strip_size_kb",
+			Help: "Strip size of the RAID bdev in KiB",
+		},
+		[]string{"target", "raid_bdev"},
+	)
+  RAID_state = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_raid_state",
+			Help: "1 if the RAID bdev is in this state, 0 otherwise",
+		},
+		[]string{"target", "raid_bdev", "state"},
+	)
+  RAID_base_bdevs = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_raid_base_bdevs",
+			Help: "Number of base bdevs of the RAID bdev",
+		},
+		[]string{"target", "raid_bdev"},
+	)
+  RAID_base_bdevs_discovered = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_raid_base_bdevs_discovered",
+			Help: "Number of base bdevs of the RAID bdev that have been discovered",
+		},
+		[]string{"target", "raid_bdev"},
+	)
+  RAID_base_bdevs_operational = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_raid_base_bdevs_operational",
+			Help: "Number of base bdevs of the RAID bdev that are operational",
+		},
+		[]string{"target", "raid_bdev"},
+	)
+  RAID_base_bdev_configured = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_raid_base_bdev_configured",
+			Help: "1 if the base bdev in this slot of the RAID bdev is configured, 0 otherwise",
+		},
+		[]string{"target", "raid_bdev", "slot", "bdev_name"},
+	)
+)
+
+//##############################################################################
+//# Function: recordRaidMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if the RPC command failed or returned invalid data
+//#
+//# Description:  This function executes the RPC command bdev_raid_get_bdevs and
+//#               records the RAID metrics
+//##############################################################################
+func recordRaidMetrics(target *Target) error {
+  var raid_bdevs []RAID_bdev
+
+  raid_json_data,err := rpcCall(target, "bdev_raid_get_bdevs", RPCParam{Name: "category", Value: "all"})
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(raid_json_data, &raid_bdevs); err != nil {
+    return err
+  }
+
+  series := newSeriesSet(target, "raid")
+
+  for _,raid := range raid_bdevs {
+    labels := prometheus.Labels{"target":target.Name, "raid_bdev":raid.Name}
+    setSeries(series, RAID_info, prometheus.Labels{"target":target.Name, "raid_bdev":raid.Name, "raid_level":raid.Raid_level, "superblock":strconv.FormatBool(raid.Superblock)}, 1)
+    setSeries(series, RAID_strip_size_kb, labels, raid.Strip_size_kb)
+    setSeries(series, RAID_base_bdevs, labels, raid.Num_base_bdevs)
+    setSeries(series, RAID_base_bdevs_discovered, labels, raid.Num_base_bdevs_discovered)
+    setSeries(series, RAID_base_bdevs_operational, labels, raid.Num_base_bdevs_operational)
+    for _,state := range raidStates {
+      setSeries(series, RAID_state, prometheus.Labels{"target":target.Name, "raid_bdev":raid.Name, "state":state}, boolToFloat(state == raid.State))
+    }
+
+    for slot,base_json_data := range raid.Base_bdevs_list {
+      base := parseRaidBaseBdev(base_json_data)
+      setSeries(series, RAID_base_bdev_configured, prometheus.Labels{"target":target.Name, "raid_bdev":raid.Name, "slot":strconv.Itoa(slot), "bdev_name":base.Name}, boolToFloat(base.Is_configured))
+    }
+  }
+  deleteStaleSeries(series)
+  return nil
+}
+
+//##############################################################################
+//# Function: parseRaidBaseBdev
+//#
+//# Input:   base_json_data - one entry of the RAID base_bdevs_list
+//# Output:  The base bdev
+//#
+//# Description:  Older SPDK versions list the base bdevs of a RAID by name only
+//#               while newer versions report an object for every base bdev.
+//#               This function accepts both
+//##############################################################################
+func parseRaidBaseBdev(base_json_data json.RawMessage) RAID_base_bdev {
+  var base RAID_base_bdev
+  if json.Unmarshal(base_json_data, &base.Name) == nil {
+    base.Is_configured = base.Name != ""
+  } else {
+    json.Unmarshal(base_json_data, &base)
+  }
+  return base
+}
+
+//##############################################################################
+//# Function: init()
+//#
+//# Input:   None
+//# Output:  None
+//#
+//# Description:  This function registers the RAID metrics in Prometheus and the
+//#               raid collector
+//##############################################################################
+func init() {
+  registerMetric(RAID_info)
+  registerMetric(RAID_strip_size_kb)
+  registerMetric(RAID_state)
+  registerMetric(RAID_base_bdevs)
+  registerMetric(RAID_base_bdevs_discovered)
+  registerMetric(RAID_base_bdevs_operational)
+  registerMetric(RAID_base_bdev_configured)
+
+  registerCollector("raid", "RAID bdev state and base bdevs (bdev_raid_get_bdevs)", recordRaidMetrics)
+}
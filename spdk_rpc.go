@@ -0,0 +1,204 @@
+//##############################################################################
+//# spdk_rpc.go
+//#
+//#
+//# Description:  SPDK JSON-RPC client.  Targets on a local UNIX socket are
+//#               called through the rpc.py script while targets with an
+//#               address are called directly over TCP, optionally with TLS, so
+//#               SPDK applications on other hosts can be monitored without
+//#               installing anything on these hosts
+//##############################################################################
+
+package main
+
+import (
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "encoding/json"
+    "fmt"
+    "net"
+    "os"
+    "os/exec"
+    "time"
+)
+
+// Number of seconds an RPC call can take when the target does not set timeout
+const defaultRPCTimeout = 10
+
+// A parameter of an RPC method.  rpc.py takes the parameters as positional
+// arguments or options while the JSON-RPC request takes them by name, with
+// the JSON type of the value, for example a number or a boolean
+type RPCParam struct {
+  Name string
+  Flag string
+  Value interface{}
+}
+
+// Definitions of the JSON-RPC 2.0 messages
+type RPC_request struct {
+  Jsonrpc string `json:"jsonrpc"`
+  Method string `json:"method"`
+  Params map[string]interface{} `json:"params,omitempty"`
+  Id int `json:"id"`
+}
+
+type RPC_error struct {
+  Code int
+  Message string
+}
+
+type RPC_response struct {
+  Result json.RawMessage
+  Error *RPC_error
+}
+
+//##############################################################################
+//# Function: rpcCall
+//#
+//# Input:   target - the SPDK application to call
+//#          method - the SPDK RPC method to execute
+//#          params - the parameters of the method
+//# Output:  The JSON data returned by SPDK and an error if the call failed
+//#
+//# Description:  This function executes an SPDK RPC method on the target and
+//#               logs the data it returned
+//##############################################################################
+func rpcCall(target *Target, method string, params ...RPCParam) ([]byte, error) {
+  var json_data []byte
+  var err error
+
+  recordMethod(target, method)
+  if target.Address != "" {
+    json_data,err = rpcCallTCP(target, method, params)
+  } else {
+    json_data,err = rpcCallScript(target, method, params)
+  }
+
+  xprint("SPDK " + target.Name + " " + method + " DATA:\n" + string(json_data))
+  if err != nil {
+    return nil, err
+  }
+  return json_data, nil
+}
+
+//##############################################################################
+//# Function: rpcCallScript
+//#
+//# Input:   target - the SPDK application to call
+//#          method - the SPDK RPC method to execute
+//#          params - the parameters of the method
+//# Output:  The JSON data returned by SPDK and an error if the call failed
+//#
+//# Description:  This function executes an SPDK RPC method through the rpc.py
+//#               script on the socket of the target
+//##############################################################################
+func rpcCallScript(target *Target, method string, params []RPCParam) ([]byte, error) {
+  var cmd_args []string
+  if target.Socket != "" {
+    cmd_args = append(cmd_args, "-s", target.Socket)
+  }
+  cmd_args = append(cmd_args, method)
+  for _,param := range params {
+    if param.Flag != "" {
+      cmd_args = append(cmd_args, param.Flag)
+    }
+    cmd_args = append(cmd_args, fmt.Sprint(param.Value))
+  }
+
+  ctx,cancel := context.WithTimeout(context.Background(), time.Duration(target.Timeout) * time.Second)
+  defer cancel()
+
+  json_data,err := exec.CommandContext(ctx, rpcCmd, cmd_args...).Output()
+  if err != nil {
+    return json_data, fmt.Errorf("%s %s failed: %v", rpcCmd, method, err)
+  }
+  return json_data, nil
+}
+
+//##############################################################################
+//# Function: rpcCallTCP
+//#
+//# Input:   target - the SPDK application to call
+//#          method - the SPDK RPC method to execute
+//#          params - the parameters of the method
+//# Output:  The result returned by SPDK and an error if the call failed
+//#
+//# Description:  This function sends a JSON-RPC request to the address of the
+//#               target, the address given to the SPDK application with -r.
+//#               The timeout of the target applies to the whole call
+//##############################################################################
+func rpcCallTCP(target *Target, method string, params []RPCParam) ([]byte, error) {
+  var conn net.Conn
+  var err error
+  var response RPC_response
+
+  timeout := time.Duration(target.Timeout) * time.Second
+  dialer := &net.Dialer{Timeout: timeout}
+  if target.tlsConfig != nil {
+    conn,err = tls.DialWithDialer(dialer, "tcp", target.Address, target.tlsConfig)
+  } else {
+    conn,err = dialer.Dial("tcp", target.Address)
+  }
+  if err != nil {
+    return nil, fmt.Errorf("%s %s failed: %v", target.Address, method, err)
+  }
+  defer conn.Close()
+  conn.SetDeadline(time.Now().Add(timeout))
+
+  request := RPC_request{Jsonrpc: "2.0", Method: method, Id: 1}
+  if len(params) > 0 {
+    request.Params = map[string]interface{}{}
+    for _,param := range params {
+      request.Params[param.Name] = param.Value
+    }
+  }
+  if err = json.NewEncoder(conn).Encode(request); err != nil {
+    return nil, fmt.Errorf("%s %s failed: %v", target.Address, method, err)
+  }
+  if err = json.NewDecoder(conn).Decode(&response); err != nil {
+    return nil, fmt.Errorf("%s %s failed: %v", target.Address, method, err)
+  }
+  if response.Error != nil {
+    return nil, fmt.Errorf("%s %s failed: %s (code %d)", target.Address, method, response.Error.Message, response.Error.Code)
+  }
+  return response.Result, nil
+}
+
+//##############################################################################
+//# Function: loadTLSConfig
+//#
+//# Input:   ca          - file with the CA certificates of the server, the
+//#                        system CAs are used when empty
+//#          cert        - file with the client certificate, optional
+//#          key         - file with the key of the client certificate
+//#          server_name - the name checked in the server certificate, the host
+//#                        of the address when empty
+//#          insecure    - do not verify the server certificate
+//# Output:  The TLS configuration and an error if a file could not be loaded
+//#
+//# Description:  This function builds the TLS configuration of a TCP target
+//##############################################################################
+func loadTLSConfig(ca string, cert string, key string, server_name string, insecure bool) (*tls.Config, error) {
+  config := &tls.Config{ServerName: server_name, InsecureSkipVerify: insecure}
+
+  if ca != "" {
+    pem,err := os.ReadFile(ca)
+    if err != nil {
+      return nil, err
+    }
+    config.RootCAs = x509.NewCertPool()
+    if !config.RootCAs.AppendCertsFromPEM(pem) {
+      return nil, fmt.Errorf("no certificate found in %s", ca)
+    }
+  }
+
+  if cert != "" || key != "" {
+    pair,err := tls.LoadX509KeyPair(cert, key)
+    if err != nil {
+      return nil, err
+    }
+    config.Certificates = []tls.Certificate{pair}
+  }
+  return config, nil
+}
@@ -0,0 +1,212 @@
+//##############################################################################
+//# spdk_rpc_test.go
+//#
+//#
+//# Description:  Tests of the JSON-RPC client against a stub SPDK RPC server
+//#               listening on 127.0.0.1
+//##############################################################################
+
+package main
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/json"
+    "math/big"
+    "net"
+    "strings"
+    "testing"
+    "time"
+)
+
+//##############################################################################
+//# Function: startRPCServer
+//#
+//# Input:   t        - the test
+//#          config   - the TLS configuration of the server, nil for plain TCP
+//#          response - the JSON-RPC response sent to every request, nothing
+//#                     is sent when empty
+//# Output:  The address of the server and the channel receiving the requests
+//#
+//# Description:  This function starts a stub SPDK RPC server on 127.0.0.1 that
+//#               answers every request with the given response.  Only the first
+//#               request not read yet is kept in the channel
+//##############################################################################
+func startRPCServer(t *testing.T, config *tls.Config, response string) (string, chan RPC_request) {
+  listener,err := net.Listen("tcp", "127.0.0.1:0")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if config != nil {
+    listener = tls.NewListener(listener, config)
+  }
+  t.Cleanup(func() { listener.Close() })
+
+  requests := make(chan RPC_request, 1)
+  go func() {
+    for {
+      conn,err := listener.Accept()
+      if err != nil {
+        return
+      }
+      go func() {
+        defer conn.Close()
+        var request RPC_request
+        if err := json.NewDecoder(conn).Decode(&request); err != nil {
+          return
+        }
+        select {
+        case requests <- request:
+        default:
+        }
+        if response == "" {
+          // Hold the connection until the client gives up
+          conn.SetDeadline(time.Now().Add(5 * time.Second))
+          conn.Read(make([]byte, 1))
+          return
+        }
+        conn.Write([]byte(response))
+      }()
+    }
+  }()
+  return listener.Addr().String(), requests
+}
+
+//##############################################################################
+//# Function: testCertificate
+//#
+//# Input:   t - the test
+//# Output:  A self-signed certificate for 127.0.0.1 and the pool trusting it
+//#
+//# Description:  This function creates the certificate of the TLS server
+//##############################################################################
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+  key,err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+  if err != nil {
+    t.Fatal(err)
+  }
+  template := &x509.Certificate{
+    SerialNumber: big.NewInt(1),
+    Subject: pkix.Name{CommonName: "spdk"},
+    IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+    NotBefore: time.Now().Add(-time.Hour),
+    NotAfter: time.Now().Add(time.Hour),
+    KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+    ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+    BasicConstraintsValid: true,
+    IsCA: true,
+  }
+  der,err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+  if err != nil {
+    t.Fatal(err)
+  }
+  cert,err := x509.ParseCertificate(der)
+  if err != nil {
+    t.Fatal(err)
+  }
+  pool := x509.NewCertPool()
+  pool.AddCert(cert)
+  return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+//##############################################################################
+//# Function: TestRPCCallTCP
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks the request sent to the server and the
+//#               handling of results, JSON-RPC errors and unanswered calls
+//##############################################################################
+func TestRPCCallTCP(t *testing.T) {
+  tests := []struct {
+    name string
+    response string
+    result string
+    err string
+  }{
+    {name: "success", response: `{"jsonrpc":"2.0","id":1,"result":[{"name":"Nvme0n1"}]}`, result: `[{"name":"Nvme0n1"}]`},
+    {name: "rpc error", response: `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"Method not found"}}`, err: "Method not found (code -32601)"},
+    {name: "invalid response", response: `not json`, err: "invalid character"},
+    {name: "timeout", response: "", err: "i/o timeout"},
+  }
+
+  for _,test := range tests {
+    address,requests := startRPCServer(t, nil, test.response)
+    target := newTarget("test")
+    target.Address = address
+    target.Timeout = 1
+
+    start := time.Now()
+    result,err := rpcCall(target, "bdev_get_bdevs", RPCParam{Name: "name", Value: "Nvme0n1"}, RPCParam{Name: "timeout", Value: 5})
+    if elapsed := time.Since(start); elapsed > 3 * time.Second {
+      t.Errorf("%s: the call took %v with a timeout of 1 second", test.name, elapsed)
+    }
+
+    select {
+    case request := <-requests:
+      if request.Jsonrpc != "2.0" || request.Method != "bdev_get_bdevs" || request.Params["name"] != "Nvme0n1" || request.Params["timeout"] != float64(5) {
+        t.Errorf("%s: the server received %+v", test.name, request)
+      }
+    default:
+      t.Errorf("%s: the server did not receive the request", test.name)
+    }
+
+    if test.err != "" {
+      if err == nil || !strings.Contains(err.Error(), test.err) {
+        t.Errorf("%s: rpcCall returned error %v, expected %q", test.name, err, test.err)
+      }
+      continue
+    }
+    if err != nil || string(result) != test.result {
+      t.Errorf("%s: rpcCall returned %s and error %v, expected %s", test.name, result, err, test.result)
+    }
+  }
+}
+
+//##############################################################################
+//# Function: TestRPCCallTLS
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks the calls to a TLS server, with a
+//#               trusted and an unknown CA and without verification
+//##############################################################################
+func TestRPCCallTLS(t *testing.T) {
+  cert,pool := testCertificate(t)
+  address,_ := startRPCServer(t, &tls.Config{Certificates: []tls.Certificate{cert}}, `{"jsonrpc":"2.0","id":1,"result":"v24.01"}`)
+
+  tests := []struct {
+    name string
+    config *tls.Config
+    err string
+  }{
+    {name: "trusted CA", config: &tls.Config{RootCAs: pool}},
+    {name: "unknown CA", config: &tls.Config{RootCAs: x509.NewCertPool()}, err: "certificate"},
+    {name: "insecure", config: &tls.Config{InsecureSkipVerify: true}},
+    {name: "wrong server name", config: &tls.Config{RootCAs: pool, ServerName: "spdk.example.com"}, err: "certificate"},
+  }
+
+  for _,test := range tests {
+    target := newTarget("test")
+    target.Address = address
+    target.Timeout = 2
+    target.tlsConfig = test.config
+
+    result,err := rpcCall(target, "spdk_get_version")
+    if test.err != "" {
+      if err == nil || !strings.Contains(err.Error(), test.err) {
+        t.Errorf("%s: rpcCall returned error %v, expected %q", test.name, err, test.err)
+      }
+      continue
+    }
+    if err != nil || string(result) != `"v24.01"` {
+      t.Errorf("%s: rpcCall returned %s and error %v", test.name, result, err)
+    }
+  }
+}
@@ -0,0 +1,287 @@
+//##############################################################################
+//# spdk_snapshot.go
+//#
+//#
+//# Description:  JSON API with the last data collected from every target.
+//#               /api/v1/snapshot returns the bdev iostat and OCF statistics as
+//#               decoded by the iostat and ocf collectors and
+//#               /api/v1/bdevs/NAME the latest counters of one bdev with the
+//#               rates computed since the previous collection
+//##############################################################################
+
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Definitions of the last data collected from a target
+type Snapshot struct {
+  mutex sync.Mutex
+  iostat *IOStat
+  iostat_time time.Time
+  previous_iostat *IOStat
+  previous_iostat_time time.Time
+  ocf *OCFStat
+  ocf_time time.Time
+  previous_ocf *OCFStat
+  previous_ocf_time time.Time
+
+  // Time of the newest data pushed to the stream
+  published_time time.Time
+}
+
+// Rates of a bdev between two collections
+type BDEV_rates struct {
+  Read_ops_per_sec float64 `json:"read_ops_per_sec"`
+  Write_ops_per_sec float64 `json:"write_ops_per_sec"`
+  Unmap_ops_per_sec float64 `json:"unmap_ops_per_sec"`
+  Read_bytes_per_sec float64 `json:"read_bytes_per_sec"`
+  Write_bytes_per_sec float64 `json:"write_bytes_per_sec"`
+  Unmap_bytes_per_sec float64 `json:"unmap_bytes_per_sec"`
+  Read_latency_us float64 `json:"read_latency_us"`
+  Write_latency_us float64 `json:"write_latency_us"`
+}
+
+// The responses of the API
+type SnapshotReport struct {
+  Target string `json:"target"`
+  Iostat_time *time.Time `json:"iostat_time,omitempty"`
+  Iostat *IOStat `json:"iostat,omitempty"`
+  Ocf_time *time.Time `json:"ocf_time,omitempty"`
+  Ocf *OCFStat `json:"ocf,omitempty"`
+}
+
+type BdevReport struct {
+  Target string `json:"target"`
+  Time time.Time `json:"time"`
+  Tick_rate float64 `json:"tick_rate"`
+  Bdev Bdev `json:"bdev"`
+  Interval float64 `json:"interval_seconds,omitempty"`
+  Rates *BDEV_rates `json:"rates,omitempty"`
+}
+
+//##############################################################################
+//# Function: storeIostat
+//#
+//# Input:   target - the target the data was collected from
+//#          iostat - the bdev iostat data
+//# Output:  None
+//#
+//# Description:  This function keeps the last two iostat collections of the
+//#               target
+//##############################################################################
+func storeIostat(target *Target, iostat IOStat) {
+  target.snapshot.mutex.Lock()
+  defer target.snapshot.mutex.Unlock()
+
+  target.snapshot.previous_iostat = target.snapshot.iostat
+  target.snapshot.previous_iostat_time = target.snapshot.iostat_time
+  target.snapshot.iostat = &iostat
+  target.snapshot.iostat_time = time.Now()
+}
+
+//##############################################################################
+//# Function: iostatRestarted
+//#
+//# Input:   target - the target the data was collected from
+//# Output:  true when the tick counter of SPDK went backwards between the last
+//#          two iostat collections
+//#
+//# Description:  This function tells whether the SPDK application was restarted
+//#               since the previous iostat collection
+//##############################################################################
+func iostatRestarted(target *Target) bool {
+  target.snapshot.mutex.Lock()
+  defer target.snapshot.mutex.Unlock()
+
+  if target.snapshot.iostat == nil || target.snapshot.previous_iostat == nil {
+    return false
+  }
+  return target.snapshot.iostat.Ticks < target.snapshot.previous_iostat.Ticks
+}
+
+//##############################################################################
+//# Function: storeOcf
+//#
+//# Input:   target - the target the data was collected from
+//#          ocf    - the OCF statistics
+//# Output:  None
+//#
+//# Description:  This function keeps the last two OCF collections of the
+//#               target
+//##############################################################################
+func storeOcf(target *Target, ocf OCFStat) {
+  target.snapshot.mutex.Lock()
+  defer target.snapshot.mutex.Unlock()
+
+  target.snapshot.previous_ocf = target.snapshot.ocf
+  target.snapshot.previous_ocf_time = target.snapshot.ocf_time
+  target.snapshot.ocf = &ocf
+  target.snapshot.ocf_time = time.Now()
+}
+
+//##############################################################################
+//# Function: bdevRates
+//#
+//# Input:   previous  - the counters of the bdev at the previous collection
+//#          current   - the counters of the bdev at the last collection
+//#          elapsed   - the number of seconds between the two collections
+//#          tick_rate - the number of latency ticks per second
+//# Output:  The rates of the bdev and false if they cannot be computed
+//#
+//# Description:  This function computes the operations and bytes per second
+//#               and the average latency of the operations between two
+//#               collections.  The counters going backwards mean the bdev was
+//#               re-created, in that case there are no rates
+//##############################################################################
+func bdevRates(previous Bdev, current Bdev, elapsed float64, tick_rate float64) (BDEV_rates, bool) {
+  var rates BDEV_rates
+
+  read_ops := current.Num_read_ops - previous.Num_read_ops
+  write_ops := current.Num_write_ops - previous.Num_write_ops
+  if elapsed <= 0 || read_ops < 0 || write_ops < 0 || current.Bytes_read < previous.Bytes_read || current.Bytes_written < previous.Bytes_written {
+    return rates, false
+  }
+
+  rates.Read_ops_per_sec = read_ops / elapsed
+  rates.Write_ops_per_sec = write_ops / elapsed
+  rates.Unmap_ops_per_sec = (current.Num_unmap_os - previous.Num_unmap_os) / elapsed
+  rates.Read_bytes_per_sec = (current.Bytes_read - previous.Bytes_read) / elapsed
+  rates.Write_bytes_per_sec = (current.Bytes_written - previous.Bytes_written) / elapsed
+  rates.Unmap_bytes_per_sec = (current.Bytes_unmapped - previous.Bytes_unmapped) / elapsed
+  if tick_rate > 0 && read_ops > 0 {
+    rates.Read_latency_us = (current.Read_latency_ticks - previous.Read_latency_ticks) / read_ops / tick_rate * 1000000
+  }
+  if tick_rate > 0 && write_ops > 0 {
+    rates.Write_latency_us = (current.Write_latency_ticks - previous.Write_latency_ticks) / write_ops / tick_rate * 1000000
+  }
+  return rates, true
+}
+
+//##############################################################################
+//# Function: findBdev
+//#
+//# Input:   iostat - the bdev iostat data
+//#          name   - the name of the bdev
+//# Output:  The bdev and false if it is not in the data
+//#
+//# Description:  This function looks up a bdev in the iostat data
+//##############################################################################
+func findBdev(iostat *IOStat, name string) (Bdev, bool) {
+  if iostat != nil {
+    for _,bdev := range iostat.Bdevs {
+      if bdev.Name == name {
+        return bdev, true
+      }
+    }
+  }
+  return Bdev{}, false
+}
+
+//##############################################################################
+//# Function: writeJSON
+//#
+//# Input:   w     - the HTTP response
+//#          value - the value to encode
+//# Output:  None
+//#
+//# Description:  This function writes a JSON response
+//##############################################################################
+func writeJSON(w http.ResponseWriter, value interface{}) {
+  w.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(w).Encode(value)
+}
+
+//##############################################################################
+//# Function: snapshotHandler
+//#
+//# Input:   w - the HTTP response
+//#          r - the HTTP request, ?target=NAME returns only this target
+//# Output:  None
+//#
+//# Description:  This function serves /api/v1/snapshot, the last iostat and
+//#               OCF data collected from every target with their time.  The
+//#               data of a collector that is not enabled or has not succeeded
+//#               yet is left out
+//##############################################################################
+func snapshotHandler(w http.ResponseWriter, r *http.Request) {
+  name := r.URL.Query().Get("target")
+  if name != "" && findTarget(name) == nil {
+    http.Error(w, "unknown target " + name, http.StatusNotFound)
+    return
+  }
+
+  reports := []SnapshotReport{}
+  for _,target := range targets {
+    if name != "" && target.Name != name {
+      continue
+    }
+
+    target.snapshot.mutex.Lock()
+    report := SnapshotReport{Target: target.Name, Iostat: target.snapshot.iostat, Ocf: target.snapshot.ocf}
+    if report.Iostat != nil {
+      iostat_time := target.snapshot.iostat_time
+      report.Iostat_time = &iostat_time
+    }
+    if report.Ocf != nil {
+      ocf_time := target.snapshot.ocf_time
+      report.Ocf_time = &ocf_time
+    }
+    target.snapshot.mutex.Unlock()
+
+    reports = append(reports, report)
+  }
+  writeJSON(w, map[string][]SnapshotReport{"targets": reports})
+}
+
+//##############################################################################
+//# Function: bdevHandler
+//#
+//# Input:   w - the HTTP response
+//#          r - the HTTP request for /api/v1/bdevs/NAME, ?target=NAME selects
+//#              the target when several targets have a bdev with this name
+//# Output:  None
+//#
+//# Description:  This function serves the latest counters of a bdev and its
+//#               rates between the last two collections
+//##############################################################################
+func bdevHandler(w http.ResponseWriter, r *http.Request) {
+  name := strings.TrimPrefix(r.URL.Path, "/api/v1/bdevs/")
+  target_name := r.URL.Query().Get("target")
+  if name == "" {
+    http.Error(w, "bdev name is missing", http.StatusBadRequest)
+    return
+  }
+
+  for _,target := range targets {
+    if target_name != "" && target.Name != target_name {
+      continue
+    }
+
+    target.snapshot.mutex.Lock()
+    current,found := findBdev(target.snapshot.iostat, name)
+    if !found {
+      target.snapshot.mutex.Unlock()
+      continue
+    }
+
+    report := BdevReport{Target: target.Name, Time: target.snapshot.iostat_time, Tick_rate: target.snapshot.iostat.Tick_rate, Bdev: current}
+    if previous,ok := findBdev(target.snapshot.previous_iostat, name); ok {
+      elapsed := target.snapshot.iostat_time.Sub(target.snapshot.previous_iostat_time).Seconds()
+      if rates,ok := bdevRates(previous, current, elapsed, report.Tick_rate); ok {
+        report.Interval = elapsed
+        report.Rates = &rates
+      }
+    }
+    target.snapshot.mutex.Unlock()
+
+    writeJSON(w, report)
+    return
+  }
+  http.Error(w, "unknown bdev " + name, http.StatusNotFound)
+}
@@ -0,0 +1,71 @@
+//##############################################################################
+//# spdk_snapshot_test.go
+//#
+//#
+//# Description:  Tests of the rates computed from two iostat collections
+//##############################################################################
+
+package main
+
+import (
+    "testing"
+)
+
+//##############################################################################
+//# Function: TestBdevRates
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks the rates and latencies of a bdev and the
+//#               intervals without valid rates
+//##############################################################################
+func TestBdevRates(t *testing.T) {
+  previous := Bdev{Name: "Nvme0n1", Num_read_ops: 100, Num_write_ops: 50, Num_unmap_os: 2, Bytes_read: 409600, Bytes_written: 204800, Bytes_unmapped: 8192,
+    Read_latency_ticks: 1000000, Write_latency_ticks: 500000}
+  current := Bdev{Name: "Nvme0n1", Num_read_ops: 300, Num_write_ops: 150, Num_unmap_os: 4, Bytes_read: 1228800, Bytes_written: 614400, Bytes_unmapped: 16384,
+    Read_latency_ticks: 5000000, Write_latency_ticks: 2500000}
+
+  rates,ok := bdevRates(previous, current, 2, 1000000)
+  expected := BDEV_rates{
+    Read_ops_per_sec: 100,
+    Write_ops_per_sec: 50,
+    Unmap_ops_per_sec: 1,
+    Read_bytes_per_sec: 409600,
+    Write_bytes_per_sec: 204800,
+    Unmap_bytes_per_sec: 4096,
+    Read_latency_us: 20000,
+    Write_latency_us: 20000,
+  }
+  if !ok || rates != expected {
+    t.Errorf("bdevRates returned %+v and %v, expected %+v", rates, ok, expected)
+  }
+
+  // Without a tick rate the latencies are unknown
+  rates,ok = bdevRates(previous, current, 2, 0)
+  if !ok || rates.Read_latency_us != 0 || rates.Write_latency_us != 0 {
+    t.Errorf("bdevRates without tick rate returned %+v and %v", rates, ok)
+  }
+
+  // No operation during the interval
+  rates,ok = bdevRates(current, current, 2, 1000000)
+  if !ok || rates != (BDEV_rates{}) {
+    t.Errorf("bdevRates of an idle bdev returned %+v and %v", rates, ok)
+  }
+
+  invalid := []struct {
+    name string
+    previous Bdev
+    current Bdev
+    elapsed float64
+  }{
+    {name: "no elapsed time", previous: previous, current: current, elapsed: 0},
+    {name: "restart", previous: current, current: previous, elapsed: 2},
+    {name: "bytes read going back", previous: previous, current: Bdev{Num_read_ops: 300, Num_write_ops: 150, Bytes_written: 614400}, elapsed: 2},
+  }
+  for _,test := range invalid {
+    if rates,ok := bdevRates(test.previous, test.current, test.elapsed, 1000000); ok {
+      t.Errorf("%s: bdevRates returned %+v, expected no rates", test.name, rates)
+    }
+  }
+}
@@ -0,0 +1,340 @@
+//##############################################################################
+//# spdk_status.go
+//#
+//#
+//# Description:  Health, readiness and status of spdk_parser.  /healthz tells
+//#               that the process is alive, /ready that every target was
+//#               collected recently and /status shows the configured targets,
+//#               their SPDK version, the RPC methods in use and the last
+//#               success and failure of every collector.  The ocf collector
+//#               enabled by default is optional, a target without OCF bdevs is
+//#               still ready
+//##############################################################################
+
+package main
+
+import (
+    "encoding/json"
+    "html/template"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Number of intervals a target can go without a successful collection before
+// spdk_parser is not ready anymore, set with -ready-intervals
+var readyIntervals int
+
+// Definitions of the status of a target
+type CollectorStatus struct {
+  Last_success time.Time `json:"last_success"`
+  Last_failure time.Time `json:"last_failure"`
+  Last_error string `json:"last_error"`
+  Optional bool `json:"optional"`
+}
+
+type TargetStatus struct {
+  mutex sync.Mutex
+  version string
+  methods map[string]bool
+  collectors map[string]*CollectorStatus
+  last_cycle time.Time
+  last_cycle_success time.Time
+}
+
+// The status of a target as returned by /status
+type TargetReport struct {
+  Name string `json:"name"`
+  Socket string `json:"socket,omitempty"`
+  Address string `json:"address,omitempty"`
+  Interval int `json:"interval"`
+  Version string `json:"spdk_version"`
+  Ready bool `json:"ready"`
+  Last_cycle time.Time `json:"last_cycle"`
+  Last_cycle_success time.Time `json:"last_cycle_success"`
+  Methods []string `json:"rpc_methods"`
+  Collectors map[string]CollectorStatus `json:"collectors"`
+}
+
+type StatusReport struct {
+  Ready bool `json:"ready"`
+  Targets []TargetReport `json:"targets"`
+}
+
+var statusTemplate = template.Must(template.New("status").Funcs(template.FuncMap{"when": formatTime}).Parse(`<!DOCTYPE html>
+<html>
+<head><title>SPDK Parser Status</title></head>
+<body>
+<h1>SPDK Parser Status</h1>
+<p>Ready: {{.Ready}}</p>
+{{range .Targets}}
+<h2>Target {{.Name}}</h2>
+<table border="1" cellpadding="4">
+<tr><td>RPC socket</td><td>{{.Socket}}</td></tr>
+<tr><td>RPC address</td><td>{{.Address}}</td></tr>
+<tr><td>Interval</td><td>{{.Interval}}s</td></tr>
+<tr><td>SPDK version</td><td>{{.Version}}</td></tr>
+<tr><td>Ready</td><td>{{.Ready}}</td></tr>
+<tr><td>Last collection</td><td>{{when .Last_cycle}}</td></tr>
+<tr><td>Last successful collection</td><td>{{when .Last_cycle_success}}</td></tr>
+<tr><td>RPC methods</td><td>{{range .Methods}}{{.}}<br>{{end}}</td></tr>
+</table>
+<h3>Collectors</h3>
+<table border="1" cellpadding="4">
+<tr><th>Collector</th><th>Last success</th><th>Last failure</th><th>Last error</th></tr>
+{{range $name,$status := .Collectors}}<tr><td>{{$name}}</td><td>{{when $status.Last_success}}</td><td>{{when $status.Last_failure}}</td><td>{{$status.Last_error}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+//##############################################################################
+//# Function: formatTime
+//#
+//# Input:   t - the time to show on the status page
+//# Output:  The formatted time, never if it is not set
+//#
+//# Description:  This function formats the times of the status page
+//##############################################################################
+func formatTime(t time.Time) string {
+  if t.IsZero() {
+    return "never"
+  }
+  return t.Format("2006-01-02 15:04:05")
+}
+
+//##############################################################################
+//# Function: newTargetStatus
+//#
+//# Input:   None
+//# Output:  An empty target status
+//#
+//# Description:  This function creates the status of a target that has not
+//#               been collected yet
+//##############################################################################
+func newTargetStatus() *TargetStatus {
+  return &TargetStatus{methods: map[string]bool{}, collectors: map[string]*CollectorStatus{}}
+}
+
+//##############################################################################
+//# Function: recordMethod
+//#
+//# Input:   target - the target the RPC method was called on
+//#          method - the RPC method
+//# Output:  None
+//#
+//# Description:  This function remembers an RPC method used with the target
+//##############################################################################
+func recordMethod(target *Target, method string) {
+  target.status.mutex.Lock()
+  defer target.status.mutex.Unlock()
+  target.status.methods[method] = true
+}
+
+//##############################################################################
+//# Function: recordCollectorStatus
+//#
+//# Input:   target - the target that was collected
+//#          name   - the collector
+//#          err    - the error returned by the collector, nil on success
+//# Output:  None
+//#
+//# Description:  This function records the last success or failure of a
+//#               collector of the target
+//##############################################################################
+func recordCollectorStatus(target *Target, name string, err error) {
+  target.status.mutex.Lock()
+  defer target.status.mutex.Unlock()
+
+  status,ok := target.status.collectors[name]
+  if !ok {
+    status = &CollectorStatus{}
+    target.status.collectors[name] = status
+  }
+  if err != nil {
+    status.Last_failure = time.Now()
+    status.Last_error = err.Error()
+  } else {
+    status.Last_success = time.Now()
+  }
+}
+
+//##############################################################################
+//# Function: recordCycleStatus
+//#
+//# Input:   target - the target that was collected
+//#          err    - the first error of the collection, nil on success
+//# Output:  None
+//#
+//# Description:  This function records the end of a collection of all the
+//#               collectors of the target
+//##############################################################################
+func recordCycleStatus(target *Target, err error) {
+  target.status.mutex.Lock()
+  defer target.status.mutex.Unlock()
+
+  target.status.last_cycle = time.Now()
+  if err == nil {
+    target.status.last_cycle_success = target.status.last_cycle
+  }
+}
+
+//##############################################################################
+//# Function: detectVersion
+//#
+//# Input:   target - the SPDK application
+//# Output:  An error if the version could not be read, the last known version
+//#          is kept then
+//#
+//# Description:  This function gets the version of the SPDK application with
+//#               spdk_get_version, or get_spdk_version on older SPDK versions
+//##############################################################################
+func detectVersion(target *Target) error {
+  var version struct { Version string }
+
+  json_data,err := rpcCall(target, "spdk_get_version")
+  if err != nil {
+    json_data,err = rpcCall(target, "get_spdk_version")
+  }
+  if err != nil {
+    return err
+  }
+  if err := json.Unmarshal(json_data, &version); err != nil {
+    return err
+  }
+
+  target.status.mutex.Lock()
+  defer target.status.mutex.Unlock()
+  target.status.version = version.Version
+  return nil
+}
+
+//##############################################################################
+//# Function: targetReport
+//#
+//# Input:   target - the target
+//# Output:  The status of the target
+//#
+//# Description:  This function copies the status of the target.  A target is
+//#               ready when all its collectors succeeded during the last
+//#               -ready-intervals intervals, not counting the optional ones
+//##############################################################################
+func targetReport(target *Target) TargetReport {
+  target.status.mutex.Lock()
+  defer target.status.mutex.Unlock()
+
+  report := TargetReport{
+    Name: target.Name,
+    Socket: target.Socket,
+    Address: target.Address,
+    Interval: target.Interval,
+    Version: target.status.version,
+    Last_cycle: target.status.last_cycle,
+    Last_cycle_success: target.status.last_cycle_success,
+    Collectors: map[string]CollectorStatus{},
+  }
+
+  // A collection takes some time on top of the interval
+  max_age := time.Duration(readyIntervals * target.Interval + target.Timeout) * time.Second
+  report.Ready = !report.Last_cycle_success.IsZero() && time.Since(report.Last_cycle_success) <= max_age
+
+  for method := range target.status.methods {
+    report.Methods = append(report.Methods, method)
+  }
+  sort.Strings(report.Methods)
+  for _,name := range target.Collectors {
+    status := CollectorStatus{}
+    if recorded,ok := target.status.collectors[name]; ok {
+      status = *recorded
+    }
+    status.Optional = target.optional[name]
+    report.Collectors[name] = status
+  }
+  return report
+}
+
+//##############################################################################
+//# Function: statusReport
+//#
+//# Input:   None
+//# Output:  The status of all the targets
+//#
+//# Description:  This function builds the status of spdk_parser, which is
+//#               ready when all its targets are ready
+//##############################################################################
+func statusReport() StatusReport {
+  report := StatusReport{Ready: true}
+  for _,target := range targets {
+    target_report := targetReport(target)
+    report.Ready = report.Ready && target_report.Ready
+    report.Targets = append(report.Targets, target_report)
+  }
+  return report
+}
+
+//##############################################################################
+//# Function: healthzHandler
+//#
+//# Input:   w - the HTTP response
+//#          r - the HTTP request
+//# Output:  None
+//#
+//# Description:  This function serves /healthz, it answers as long as the
+//#               process is running
+//##############################################################################
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+  w.Write([]byte("OK\n"))
+}
+
+//##############################################################################
+//# Function: readyHandler
+//#
+//# Input:   w - the HTTP response
+//#          r - the HTTP request
+//# Output:  None
+//#
+//# Description:  This function serves /ready.  It returns 503 with the targets
+//#               that are not ready when one of them did not have a successful
+//#               collection during the last -ready-intervals intervals
+//##############################################################################
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+  var not_ready []string
+  for _,target := range statusReport().Targets {
+    if !target.Ready {
+      not_ready = append(not_ready, target.Name)
+    }
+  }
+
+  if len(not_ready) > 0 {
+    http.Error(w, "Not ready: " + strings.Join(not_ready, ", "), http.StatusServiceUnavailable)
+    return
+  }
+  w.Write([]byte("OK\n"))
+}
+
+//##############################################################################
+//# Function: statusHandler
+//#
+//# Input:   w - the HTTP response
+//#          r - the HTTP request, ?format=json or an Accept header with
+//#              application/json returns JSON
+//# Output:  None
+//#
+//# Description:  This function serves /status as an HTML page or as JSON
+//##############################################################################
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+  report := statusReport()
+
+  if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(report)
+    return
+  }
+  w.Header().Set("Content-Type", "text/html; charset=utf-8")
+  if err := statusTemplate.Execute(w, report); err != nil {
+    xprint("ERROR: status page: " + err.Error())
+  }
+}
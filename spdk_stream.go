@@ -0,0 +1,282 @@
+//##############################################################################
+//# spdk_stream.go
+//#
+//#
+//# Description:  Live stream of the collections.  After every collection of a
+//#               target a sample with the IOPS, bandwidth and latency of every
+//#               bdev and the OCF hit ratio is pushed to the clients of
+//#               /api/v1/stream as Server-Sent Events
+//##############################################################################
+
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// Definitions of the samples pushed after every collection
+type OCF_sample struct {
+  Hit_ratio float64 `json:"hit_ratio"`
+  Read_hits float64 `json:"read_hits"`
+  Read_partial_misses float64 `json:"read_partial_misses"`
+  Read_full_misses float64 `json:"read_full_misses"`
+  Write_hits float64 `json:"write_hits"`
+  Write_partial_misses float64 `json:"write_partial_misses"`
+  Write_full_misses float64 `json:"write_full_misses"`
+  Pass_through float64 `json:"pass_through"`
+  Occupancy_percent float64 `json:"occupancy_percent"`
+  Clean_percent float64 `json:"clean_percent"`
+  Dirty_percent float64 `json:"dirty_percent"`
+  Free_percent float64 `json:"free_percent"`
+}
+
+type Sample struct {
+  Target string `json:"target"`
+  Time time.Time `json:"time"`
+  Bdevs map[string]BDEV_rates `json:"bdevs,omitempty"`
+  Ocf *OCF_sample `json:"ocf,omitempty"`
+}
+
+// Clients of /api/v1/stream
+var (
+  sampleSubscribers = map[chan Sample]bool{}
+  sampleMutex sync.Mutex
+)
+
+// Number of seconds between two keep alive comments on an idle stream
+const streamKeepAlive = 15
+
+//##############################################################################
+//# Function: ocfPercentage
+//#
+//# Input:   data - an OCF statistic
+//# Output:  The percentage of the statistic, 0 if SPDK did not report it
+//#
+//# Description:  SPDK reports the OCF percentages as strings
+//##############################################################################
+func ocfPercentage(data OCF_data) float64 {
+  value,_ := strconv.ParseFloat(data.Percentage, 64)
+  return value
+}
+
+//##############################################################################
+//# Function: buildSample
+//#
+//# Input:   target - the target that was collected
+//# Output:  The sample of the last collection of the target and false when
+//#          neither iostat nor OCF data was stored since the last sample
+//#
+//# Description:  This function computes the rates of every bdev and the OCF
+//#               requests between the last two collections.  The OCF request
+//#               counts are the number of requests during the interval and the
+//#               hit ratio the share of them that hit the cache.  Only the data
+//#               stored since the last sample is used and the sample is dated
+//#               by the iostat collection, or by the OCF one without iostat
+//##############################################################################
+func buildSample(target *Target) (Sample, bool) {
+  snapshot := target.snapshot
+  snapshot.mutex.Lock()
+  defer snapshot.mutex.Unlock()
+
+  sample := Sample{Target: target.Name, Bdevs: map[string]BDEV_rates{}}
+
+  iostat_fresh := snapshot.iostat_time.After(snapshot.published_time)
+  ocf_fresh := snapshot.ocf_time.After(snapshot.published_time)
+  if !iostat_fresh && !ocf_fresh {
+    return sample, false
+  }
+  if iostat_fresh {
+    sample.Time = snapshot.iostat_time
+  } else {
+    sample.Time = snapshot.ocf_time
+  }
+  if ocf_fresh && snapshot.ocf_time.After(snapshot.iostat_time) {
+    snapshot.published_time = snapshot.ocf_time
+  } else {
+    snapshot.published_time = snapshot.iostat_time
+  }
+
+  if iostat_fresh && snapshot.previous_iostat != nil {
+    elapsed := snapshot.iostat_time.Sub(snapshot.previous_iostat_time).Seconds()
+    for _,current := range snapshot.iostat.Bdevs {
+      previous,ok := findBdev(snapshot.previous_iostat, current.Name)
+      if !ok {
+        continue
+      }
+      if rates,ok := bdevRates(previous, current, elapsed, snapshot.iostat.Tick_rate); ok {
+        sample.Bdevs[current.Name] = rates
+      }
+    }
+  }
+
+  if ocf_fresh && snapshot.previous_ocf != nil {
+    current := snapshot.ocf.Requests
+    previous := snapshot.previous_ocf.Requests
+    ocf := &OCF_sample{
+      Read_hits: current.Rd_hits.Count - previous.Rd_hits.Count,
+      Read_partial_misses: current.Rd_partial_misses.Count - previous.Rd_partial_misses.Count,
+      Read_full_misses: current.Rd_full_misses.Count - previous.Rd_full_misses.Count,
+      Write_hits: current.Wr_hits.Count - previous.Wr_hits.Count,
+      Write_partial_misses: current.Wr_partial_misses.Count - previous.Wr_partial_misses.Count,
+      Write_full_misses: current.Wr_full_misses.Count - previous.Wr_full_misses.Count,
+      Pass_through: current.Rd_pt.Count + current.Wr_pt.Count - previous.Rd_pt.Count - previous.Wr_pt.Count,
+      Occupancy_percent: ocfPercentage(snapshot.ocf.Usage.Occupancy),
+      Clean_percent: ocfPercentage(snapshot.ocf.Usage.Clean),
+      Dirty_percent: ocfPercentage(snapshot.ocf.Usage.Dirty),
+      Free_percent: ocfPercentage(snapshot.ocf.Usage.Free),
+    }
+    requests := current.Rd_total.Count + current.Wr_total.Count - previous.Rd_total.Count - previous.Wr_total.Count
+    if requests > 0 {
+      ocf.Hit_ratio = (ocf.Read_hits + ocf.Write_hits) / requests
+    }
+    sample.Ocf = ocf
+  }
+  return sample, true
+}
+
+//##############################################################################
+//# Function: publishSample
+//#
+//# Input:   target - the target that was collected
+//# Output:  None
+//#
+//# Description:  This function adds the sample of the last collection of the
+//#               target to its history and pushes it to the clients of the
+//#               stream.  Nothing is published when the collection stored no
+//#               new iostat or OCF data.  A client that did not read the
+//#               previous samples yet misses this one instead of slowing down
+//#               the collection
+//##############################################################################
+func publishSample(target *Target) {
+  sample,ok := buildSample(target)
+  if !ok {
+    return
+  }
+  addSample(target.history, sample)
+
+  sampleMutex.Lock()
+  defer sampleMutex.Unlock()
+  for subscriber := range sampleSubscribers {
+    select {
+    case subscriber <- sample:
+    default:
+    }
+  }
+}
+
+//##############################################################################
+//# Function: subscribeSamples
+//#
+//# Input:   None
+//# Output:  The channel the samples are pushed to
+//#
+//# Description:  This function adds a client to the stream
+//##############################################################################
+func subscribeSamples() chan Sample {
+  subscriber := make(chan Sample, 16)
+
+  sampleMutex.Lock()
+  defer sampleMutex.Unlock()
+  sampleSubscribers[subscriber] = true
+  return subscriber
+}
+
+//##############################################################################
+//# Function: unsubscribeSamples
+//#
+//# Input:   subscriber - the channel returned by subscribeSamples
+//# Output:  None
+//#
+//# Description:  This function removes a client from the stream
+//##############################################################################
+func unsubscribeSamples(subscriber chan Sample) {
+  sampleMutex.Lock()
+  defer sampleMutex.Unlock()
+  delete(sampleSubscribers, subscriber)
+}
+
+//##############################################################################
+//# Function: filterSample
+//#
+//# Input:   sample - the sample of a collection
+//#          bdevs  - the bdevs to keep, all of them when empty
+//# Output:  The sample with only the given bdevs
+//#
+//# Description:  This function applies the bdev filter of a stream client
+//##############################################################################
+func filterSample(sample Sample, bdevs []string) Sample {
+  if len(bdevs) == 0 {
+    return sample
+  }
+  filtered := sample
+  filtered.Bdevs = map[string]BDEV_rates{}
+  for _,name := range bdevs {
+    if rates,ok := sample.Bdevs[name]; ok {
+      filtered.Bdevs[name] = rates
+    }
+  }
+  return filtered
+}
+
+//##############################################################################
+//# Function: streamHandler
+//#
+//# Input:   w - the HTTP response
+//#          r - the HTTP request.  ?target=NAME only streams this target and
+//#              ?bdev=NAME, which can be repeated, only these bdevs
+//# Output:  None
+//#
+//# Description:  This function serves /api/v1/stream.  Every sample is sent as
+//#               a Server-Sent Event with the JSON sample as data until the
+//#               client disconnects
+//##############################################################################
+func streamHandler(w http.ResponseWriter, r *http.Request) {
+  flusher,ok := w.(http.Flusher)
+  if !ok {
+    http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+    return
+  }
+
+  target_name := r.URL.Query().Get("target")
+  if target_name != "" && findTarget(target_name) == nil {
+    http.Error(w, "unknown target " + target_name, http.StatusNotFound)
+    return
+  }
+  bdevs := r.URL.Query()["bdev"]
+
+  subscriber := subscribeSamples()
+  defer unsubscribeSamples(subscriber)
+
+  w.Header().Set("Content-Type", "text/event-stream")
+  w.Header().Set("Cache-Control", "no-cache")
+  w.Header().Set("Connection", "keep-alive")
+  w.WriteHeader(http.StatusOK)
+  flusher.Flush()
+
+  keep_alive := time.NewTicker(streamKeepAlive * time.Second)
+  defer keep_alive.Stop()
+
+  for {
+    select {
+    case <-r.Context().Done():
+      return
+    case <-keep_alive.C:
+      fmt.Fprint(w, ": keep-alive\n\n")
+    case sample := <-subscriber:
+      if target_name != "" && sample.Target != target_name {
+        continue
+      }
+      json_data,err := json.Marshal(filterSample(sample, bdevs))
+      if err != nil {
+        continue
+      }
+      fmt.Fprintf(w, "event: sample\ndata: %s\n\n", json_data)
+    }
+    flusher.Flush()
+  }
+}
@@ -0,0 +1,58 @@
+//##############################################################################
+//# spdk_stream_test.go
+//#
+//#
+//# Description:  Tests of the samples pushed to /api/v1/stream
+//##############################################################################
+
+package main
+
+import (
+    "testing"
+    "time"
+)
+
+//##############################################################################
+//# Function: TestBuildSample
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks that a sample is dated by the iostat
+//#               collection and only built once for the data that was stored
+//##############################################################################
+func TestBuildSample(t *testing.T) {
+  target := newTarget("test")
+
+  if _,ok := buildSample(target); ok {
+    t.Errorf("a sample was built before any collection")
+  }
+
+  storeIostat(target, IOStat{Tick_rate: 1000000, Bdevs: []Bdev{{Name: "Nvme0n1", Num_read_ops: 100}}})
+  time.Sleep(10 * time.Millisecond)
+  storeIostat(target, IOStat{Tick_rate: 1000000, Bdevs: []Bdev{{Name: "Nvme0n1", Num_read_ops: 200}}})
+
+  sample,ok := buildSample(target)
+  if !ok {
+    t.Fatalf("no sample was built after two collections")
+  }
+  if !sample.Time.Equal(target.snapshot.iostat_time) {
+    t.Errorf("the sample is dated %v, expected the iostat collection %v", sample.Time, target.snapshot.iostat_time)
+  }
+  if _,ok := sample.Bdevs["Nvme0n1"]; !ok || sample.Ocf != nil {
+    t.Errorf("the sample has bdevs %v and OCF %v, expected only Nvme0n1", sample.Bdevs, sample.Ocf)
+  }
+
+  // A collection that stored nothing, like a failed iostat collector
+  if sample,ok := buildSample(target); ok {
+    t.Errorf("a sample %+v was built again without new data", sample)
+  }
+
+  // Only OCF data was stored, the old bdev rates are not sent again
+  storeOcf(target, OCFStat{})
+  storeOcf(target, OCFStat{})
+  sample,ok = buildSample(target)
+  if !ok || len(sample.Bdevs) != 0 || sample.Ocf == nil || !sample.Time.Equal(target.snapshot.ocf_time) {
+    t.Errorf("buildSample after an OCF collection returned %+v and %v", sample, ok)
+  }
+}
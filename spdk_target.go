@@ -0,0 +1,514 @@
+//##############################################################################
+//# spdk_target.go
+//#
+//#
+//# Description:  SPDK applications scraped by spdk_parser.  Every target has
+//#               its own RPC socket, collection interval and collectors, and
+//#               every metric recorded for it carries a target label.  Targets
+//#               are given with -target, when none is given a single target
+//#               named "default" is built from -sleep, -cache and -collectors
+//##############################################################################
+
+package main
+
+import (
+    "crypto/tls"
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// The collectors enabled when -target does not list any
+var defaultCollectors = []string{"iostat", "ocf"}
+
+type Target struct {
+  Name string
+  Socket string
+  Address string
+  Timeout int
+  Interval int
+  Cache string
+  Collectors []string
+  tlsConfig *tls.Config
+
+  // Collectors whose failures are logged but do not fail the collection,
+  // the ocf collector when it was not asked for
+  optional map[string]bool
+
+  // Samples of the previous collection kept by the collectors that compute
+  // rates or ratios.  They are only used from the goroutine of the target
+  qosSamples map[string]QOS_sample
+  aggregateBdevs map[string]Bdev
+  nvmfHosts map[string]map[string]bool
+
+  // Bdev graph of the last collection, reused by the aggregate collector
+  // while the bdevs do not change
+  topology *Topology
+
+  // Results of the collections, shown at /status
+  status *TargetStatus
+
+  // Last iostat and OCF data, served at /api/v1
+  snapshot *Snapshot
+
+  // Recent samples, shown on the dashboard
+  history *History
+
+  // Series set by the last successful collection of every collector
+  series map[string]*SeriesSet
+}
+
+// Metrics with per-target series, the GaugeVecs and CounterVecs
+type targetVec interface {
+  DeletePartialMatch(labels prometheus.Labels) int
+}
+
+// A single series of a GaugeVec or CounterVec can be deleted
+type seriesVec interface {
+  Delete(labels prometheus.Labels) bool
+}
+
+// Series set by a collector during one collection of a target.  Collectors
+// recording inventories set the current series through it and delete the
+// series of the previous collection that were not set again only once the
+// whole collection succeeded, so a scrape never sees a half recorded inventory
+type SeriesSet struct {
+  target *Target
+  name string
+  series map[seriesVec]map[string]prometheus.Labels
+  // Metric names of the counters, used to forget their last values
+  counters map[seriesVec]string
+}
+
+// All the configured targets, in the order they were given
+var targets []*Target
+
+// Values given to the repeatable -target flag
+type targetFlags []string
+
+func (t *targetFlags) String() string {
+  return strings.Join(*t, " ")
+}
+
+func (t *targetFlags) Set(value string) error {
+  *t = append(*t, value)
+  return nil
+}
+
+//##############################################################################
+//# Function: newTarget
+//#
+//# Input:   name - the value of the target label
+//# Output:  A target using the default interval, cache and collectors
+//#
+//# Description:  This function creates a target with the values of -sleep and
+//#               -cache.  An empty socket lets rpc.py use its default socket
+//##############################################################################
+func newTarget(name string) *Target {
+  return &Target{
+    Name: name,
+    Timeout: defaultRPCTimeout,
+    Interval: sleepTime,
+    Cache: cache,
+    Collectors: append([]string{}, defaultCollectors...),
+    optional: map[string]bool{"ocf": true},
+    qosSamples: map[string]QOS_sample{},
+    aggregateBdevs: map[string]Bdev{},
+    nvmfHosts: map[string]map[string]bool{},
+    status: newTargetStatus(),
+    snapshot: &Snapshot{},
+    series: map[string]*SeriesSet{},
+    history: newHistory(historySize(sleepTime)),
+  }
+}
+
+//##############################################################################
+//# Function: parseTarget
+//#
+//# Input:   spec       - the value given to -target, a comma separated list
+//#                       of name=, socket=, address=, timeout=, interval=,
+//#                       cache=, collectors= and the tls keys.  The collectors
+//#                       list is comma separated as well, so values without a
+//#                       key are added to the previous key
+//#          collectors - the collectors of the target when collectors= is
+//#                       not given
+//# Output:  The target and an error if the value is invalid
+//#
+//# Description:  This function parses one -target value, for example
+//#               name=nvmf,socket=/var/tmp/nvmf.sock,interval=5,collectors=iostat,nvmf
+//#               or name=node2,address=10.0.0.2:5260,tls=true,tls_ca=/etc/spdk/ca.pem
+//##############################################################################
+func parseTarget(spec string, collectors []string) (*Target, error) {
+  values := map[string]string{}
+  key := ""
+  for _,field := range strings.Split(spec, ",") {
+    if i := strings.Index(field, "="); i >= 0 {
+      key = strings.TrimSpace(field[:i])
+      values[key] = strings.TrimSpace(field[i+1:])
+    } else if key != "" {
+      values[key] += "," + strings.TrimSpace(field)
+    } else {
+      return nil, fmt.Errorf("invalid target %q, expected name=NAME,socket=PATH,...", spec)
+    }
+  }
+
+  var use_tls, tls_insecure bool
+  var tls_ca, tls_cert, tls_key, tls_server_name string
+
+  target := newTarget(values["name"])
+  target.Collectors = append([]string{}, collectors...)
+  for key,value := range values {
+    var err error
+    switch key {
+    case "name":
+    case "socket":
+      target.Socket = value
+    case "address":
+      target.Address = value
+    case "timeout":
+      target.Timeout,err = strconv.Atoi(value)
+      if err != nil || target.Timeout < 1 {
+        return nil, fmt.Errorf("invalid timeout %q in target %q", value, spec)
+      }
+    case "tls":
+      use_tls,err = strconv.ParseBool(value)
+    case "tls_insecure":
+      tls_insecure,err = strconv.ParseBool(value)
+    case "tls_ca":
+      tls_ca = value
+    case "tls_cert":
+      tls_cert = value
+    case "tls_key":
+      tls_key = value
+    case "tls_server_name":
+      tls_server_name = value
+    case "cache":
+      target.Cache = value
+    case "interval":
+      interval,err := strconv.Atoi(value)
+      if err != nil || interval < 1 {
+        return nil, fmt.Errorf("invalid interval %q in target %q", value, spec)
+      }
+      target.Interval = interval
+    case "collectors":
+      names,err := parseCollectors(value)
+      if err != nil {
+        return nil, err
+      }
+      target.Collectors = names
+      target.optional = map[string]bool{}
+    default:
+      return nil, fmt.Errorf("unknown key %q in target %q", key, spec)
+    }
+    if err != nil {
+      return nil, fmt.Errorf("invalid %s %q in target %q", key, value, spec)
+    }
+  }
+
+  if target.Name == "" {
+    return nil, fmt.Errorf("target %q has no name", spec)
+  }
+  if target.Socket != "" && target.Address != "" {
+    return nil, fmt.Errorf("target %q has both a socket and an address", spec)
+  }
+  // Every tls key enables TLS, tls=false with one of them is a mistake
+  tls_keys := tls_ca != "" || tls_cert != "" || tls_key != "" || tls_server_name != "" || tls_insecure
+  if _,ok := values["tls"]; ok && !use_tls && tls_keys {
+    return nil, fmt.Errorf("target %q has tls=false with other tls keys", spec)
+  }
+  if (tls_cert == "") != (tls_key == "") {
+    return nil, fmt.Errorf("target %q needs both tls_cert and tls_key", spec)
+  }
+  if use_tls || tls_keys {
+    if target.Address == "" {
+      return nil, fmt.Errorf("target %q uses TLS without an address", spec)
+    }
+    config,err := loadTLSConfig(tls_ca, tls_cert, tls_key, tls_server_name, tls_insecure)
+    if err != nil {
+      return nil, fmt.Errorf("target %s: %v", target.Name, err)
+    }
+    target.tlsConfig = config
+  }
+  target.history.size = historySize(target.Interval)
+  return target, nil
+}
+
+//##############################################################################
+//# Function: parseTargets
+//#
+//# Input:   specs      - the values given to -target
+//#          collectors - the value of -collectors, used for the default target
+//# Output:  The targets and an error if one of them is invalid
+//#
+//# Description:  This function builds the list of targets.  The targets run the
+//#               iostat and ocf collectors and the ones in -collectors, unless
+//#               their -target value lists its own collectors.  The ocf
+//#               collector is optional unless it is listed in -collectors or
+//#               in collectors=.  Without -target a single target named
+//#               "default" scrapes the default RPC socket
+//##############################################################################
+func parseTargets(specs []string, collectors string) ([]*Target, error) {
+  var parsed []*Target
+
+  names,err := parseCollectors(collectors)
+  if err != nil {
+    return nil, err
+  }
+  enabled := append([]string{}, defaultCollectors...)
+  ocf := false
+  for _,name := range names {
+    if name != "iostat" && name != "ocf" {
+      enabled = append(enabled, name)
+    }
+    ocf = ocf || name == "ocf"
+  }
+
+  if len(specs) == 0 {
+    target := newTarget("default")
+    target.Collectors = enabled
+    if ocf {
+      delete(target.optional, "ocf")
+    }
+    return []*Target{target}, nil
+  }
+
+  seen := map[string]bool{}
+  for _,spec := range specs {
+    target,err := parseTarget(spec, enabled)
+    if err != nil {
+      return nil, err
+    }
+    if ocf {
+      delete(target.optional, "ocf")
+    }
+    if seen[target.Name] {
+      return nil, fmt.Errorf("duplicate target name %q", target.Name)
+    }
+    seen[target.Name] = true
+    parsed = append(parsed, target)
+  }
+  return parsed, nil
+}
+
+//##############################################################################
+//# Function: findTarget
+//#
+//# Input:   name - the name of the target, empty for the first target
+//# Output:  The target or nil if there is no target with this name
+//#
+//# Description:  This function looks up a configured target
+//##############################################################################
+func findTarget(name string) *Target {
+  for _,target := range targets {
+    if name == "" || target.Name == name {
+      return target
+    }
+  }
+  return nil
+}
+
+//##############################################################################
+//# Function: resetTarget
+//#
+//# Input:   target - the target whose series are removed
+//#          vec    - the metric to remove them from
+//# Output:  None
+//#
+//# Description:  This function removes all the series of the target from a
+//#               metric.  Only the series of the given target are removed so
+//#               the targets do not remove each other's series
+//##############################################################################
+func resetTarget(target *Target, vec targetVec) {
+  vec.DeletePartialMatch(prometheus.Labels{"target":target.Name})
+}
+
+//##############################################################################
+//# Function: newSeriesSet
+//#
+//# Input:   target - the target being collected
+//#          name   - the collector, each collector keeps its own series
+//# Output:  An empty set of series
+//#
+//# Description:  This function starts recording the series of one collection
+//##############################################################################
+func newSeriesSet(target *Target, name string) *SeriesSet {
+  return &SeriesSet{target: target, name: name, series: map[seriesVec]map[string]prometheus.Labels{}, counters: map[seriesVec]string{}}
+}
+
+//##############################################################################
+//# Function: addSeries
+//#
+//# Input:   set    - the series of the collection
+//#          vec    - the metric
+//#          labels - the labels of the series
+//# Output:  None
+//#
+//# Description:  This function remembers a series was seen during this
+//#               collection.  The labels are copied so the caller can reuse
+//#               the map for the next series
+//##############################################################################
+func addSeries(set *SeriesSet, vec seriesVec, labels prometheus.Labels) {
+  var keys []string
+  series_labels := prometheus.Labels{}
+  for key,label := range labels {
+    keys = append(keys, key + "=" + label)
+    series_labels[key] = label
+  }
+  sort.Strings(keys)
+
+  if set.series[vec] == nil {
+    set.series[vec] = map[string]prometheus.Labels{}
+  }
+  set.series[vec][strings.Join(keys, ",")] = series_labels
+}
+
+//##############################################################################
+//# Function: setSeries
+//#
+//# Input:   set    - the series of the collection
+//#          vec    - the metric
+//#          labels - the labels of the series, with the target label
+//#          value  - the value of the series
+//# Output:  None
+//#
+//# Description:  This function sets the value of a series and remembers it
+//#               was seen during this collection
+//##############################################################################
+func setSeries(set *SeriesSet, vec *prometheus.GaugeVec, labels prometheus.Labels, value float64) {
+  addSeries(set, vec, labels)
+  vec.With(labels).Set(value)
+}
+
+//##############################################################################
+//# Function: setSeriesCounter
+//#
+//# Input:   set    - the series of the collection
+//#          vec    - the counter
+//#          name   - the metric name, used to remember the last value
+//#          labels - the labels of the series, with the target label
+//#          value  - the cumulative value reported by SPDK
+//# Output:  None
+//#
+//# Description:  This function updates a counter with setCounter and remembers
+//#               it was seen during this collection
+//##############################################################################
+func setSeriesCounter(set *SeriesSet, vec *prometheus.CounterVec, name string, labels prometheus.Labels, value float64) {
+  addSeries(set, vec, labels)
+  set.counters[vec] = name
+  setCounter(vec, name, labels, value)
+}
+
+//##############################################################################
+//# Function: deleteStaleSeries
+//#
+//# Input:   set - the series of the collection
+//# Output:  None
+//#
+//# Description:  This function deletes the series set by the previous
+//#               successful collection of the collector that were not set by
+//#               this one, for example a removed subsystem or bdev, and
+//#               forgets the last values of the deleted counters.  It is
+//#               called at the end of a successful collection so a failed
+//#               collection keeps the last known series
+//##############################################################################
+func deleteStaleSeries(set *SeriesSet) {
+  if previous,ok := set.target.series[set.name]; ok {
+    for vec,series := range previous.series {
+      for key,labels := range series {
+        if _,current := set.series[vec][key]; !current {
+          vec.Delete(labels)
+          if name,counter := previous.counters[vec]; counter {
+            forgetCounter(name, labels)
+          }
+        }
+      }
+    }
+  }
+  set.target.series[set.name] = set
+}
+
+//##############################################################################
+//# Function: removeTarget
+//#
+//# Input:   target - the target whose series are removed
+//# Output:  None
+//#
+//# Description:  This function removes all the series of a target from every
+//#               registered metric and forgets the last values of its counters
+//##############################################################################
+func removeTarget(target *Target) {
+  for _,metric := range metrics {
+    if vec,ok := metric.(targetVec); ok {
+      resetTarget(target, vec)
+    }
+  }
+
+  counterMutex.Lock()
+  defer counterMutex.Unlock()
+  for id := range counterValues {
+    if strings.Contains(id + ",", ",target=" + target.Name + ",") {
+      delete(counterValues, id)
+    }
+  }
+}
+
+//##############################################################################
+//# Function: collectTarget
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  The errors returned by the collectors of the target that are not
+//#          optional, one line per collector
+//#
+//# Description:  This function runs every collector of the target once and
+//#               records their status.  A failing collector is logged and does
+//#               not stop the others
+//##############################################################################
+func collectTarget(target *Target) error {
+  var errs []error
+  for _,name := range target.Collectors {
+    err := collectors[name].Collect(target)
+    recordCollectorStatus(target, name, err)
+    if err != nil {
+      xprint("ERROR: target " + target.Name + " collector " + name + ": " + err.Error())
+      if !target.optional[name] {
+        // A collector can fail on several RPCs, keep them on its line
+        errs = append(errs, fmt.Errorf("collector %s: %s", name, strings.ReplaceAll(err.Error(), "\n", "; ")))
+      }
+    }
+  }
+  err := errors.Join(errs...)
+  recordCycleStatus(target, err)
+  return err
+}
+
+//##############################################################################
+//# Function: recordTargetMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  None
+//#
+//# Description:  This function gets the SPDK version of a target and runs its
+//#               collectors in their own loop so a slow or failing target does
+//#               not delay the others.  Each collection is pushed to the stream.
+//#               The version is read again after a failed collection or a
+//#               restart of SPDK, which may have been upgraded meanwhile
+//##############################################################################
+func recordTargetMetrics(target *Target) {
+  go func() {
+    refresh_version := true
+    for {
+      if refresh_version {
+        refresh_version = detectVersion(target) != nil
+      }
+      err := collectTarget(target)
+      refresh_version = refresh_version || err != nil || iostatRestarted(target)
+      publishSample(target)
+      time.Sleep(time.Duration(target.Interval) * time.Second)
+    }
+  }()
+}
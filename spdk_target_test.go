@@ -0,0 +1,166 @@
+//##############################################################################
+//# spdk_target_test.go
+//#
+//#
+//# Description:  Tests of the -target and -collectors parsing
+//##############################################################################
+
+package main
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+)
+
+//##############################################################################
+//# Function: TestParseTarget
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks the keys of a -target value and the
+//#               errors returned for invalid combinations
+//##############################################################################
+func TestParseTarget(t *testing.T) {
+  defaults := []string{"iostat", "ocf", "nvmf"}
+
+  tests := []struct {
+    spec string
+    err string
+    socket string
+    address string
+    interval int
+    timeout int
+    collectors []string
+    tls bool
+  }{
+    {spec: "name=nvmf,socket=/var/tmp/nvmf.sock,interval=5,collectors=iostat,thread",
+     socket: "/var/tmp/nvmf.sock", interval: 5, timeout: defaultRPCTimeout, collectors: []string{"iostat", "thread"}},
+    {spec: "name=vhost, socket=/var/tmp/vhost.sock",
+     socket: "/var/tmp/vhost.sock", timeout: defaultRPCTimeout, collectors: defaults},
+    {spec: "name=node2,address=10.0.0.2:5260,timeout=3,tls=true",
+     address: "10.0.0.2:5260", timeout: 3, collectors: defaults, tls: true},
+    {spec: "name=node2,address=10.0.0.2:5260,tls_server_name=spdk",
+     address: "10.0.0.2:5260", timeout: defaultRPCTimeout, collectors: defaults, tls: true},
+    {spec: "socket=/var/tmp/nvmf.sock", err: "has no name"},
+    {spec: "nvmf", err: "expected name=NAME"},
+    {spec: "name=nvmf,socket=/var/tmp/nvmf.sock,address=10.0.0.2:5260", err: "both a socket and an address"},
+    {spec: "name=nvmf,port=5260", err: "unknown key"},
+    {spec: "name=nvmf,interval=0", err: "invalid interval"},
+    {spec: "name=nvmf,timeout=ten", err: "invalid timeout"},
+    {spec: "name=nvmf,collectors=iostat,unknown", err: "unknown collector"},
+    {spec: "name=nvmf,tls=yes,address=10.0.0.2:5260", err: "invalid tls"},
+    {spec: "name=nvmf,socket=/var/tmp/nvmf.sock,tls=true", err: "without an address"},
+    {spec: "name=nvmf,address=10.0.0.2:5260,tls=false,tls_ca=/etc/spdk/ca.pem", err: "tls=false"},
+    {spec: "name=nvmf,address=10.0.0.2:5260,tls_key=/etc/spdk/key.pem", err: "both tls_cert and tls_key"},
+    {spec: "name=nvmf,address=10.0.0.2:5260,tls_cert=/etc/spdk/cert.pem", err: "both tls_cert and tls_key"},
+  }
+
+  for _,test := range tests {
+    target,err := parseTarget(test.spec, defaults)
+    if test.err != "" {
+      if err == nil || !strings.Contains(err.Error(), test.err) {
+        t.Errorf("parseTarget(%q) returned error %v, expected %q", test.spec, err, test.err)
+      }
+      continue
+    }
+    if err != nil {
+      t.Errorf("parseTarget(%q) returned error %v", test.spec, err)
+      continue
+    }
+    if target.Socket != test.socket || target.Address != test.address || target.Timeout != test.timeout {
+      t.Errorf("parseTarget(%q) returned socket %q, address %q and timeout %d", test.spec, target.Socket, target.Address, target.Timeout)
+    }
+    if test.interval != 0 && target.Interval != test.interval {
+      t.Errorf("parseTarget(%q) returned interval %d, expected %d", test.spec, target.Interval, test.interval)
+    }
+    if !reflect.DeepEqual(target.Collectors, test.collectors) {
+      t.Errorf("parseTarget(%q) returned collectors %v, expected %v", test.spec, target.Collectors, test.collectors)
+    }
+    if (target.tlsConfig != nil) != test.tls {
+      t.Errorf("parseTarget(%q) returned TLS %v, expected %v", test.spec, target.tlsConfig != nil, test.tls)
+    }
+  }
+}
+
+//##############################################################################
+//# Function: TestParseTargets
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks that -collectors applies to the default
+//#               target and to the targets that do not list their collectors
+//##############################################################################
+func TestParseTargets(t *testing.T) {
+  tests := []struct {
+    specs []string
+    collectors string
+    expected map[string][]string
+    err string
+  }{
+    {collectors: "", expected: map[string][]string{"default": {"iostat", "ocf"}}},
+    {collectors: "nvmf,ocf,thread", expected: map[string][]string{"default": {"iostat", "ocf", "nvmf", "thread"}}},
+    {specs: []string{"name=a,socket=/a.sock", "name=b,socket=/b.sock,collectors=iostat"}, collectors: "nvmf",
+     expected: map[string][]string{"a": {"iostat", "ocf", "nvmf"}, "b": {"iostat"}}},
+    {specs: []string{"name=a,socket=/a.sock", "name=a,socket=/b.sock"}, err: "duplicate target name"},
+    {collectors: "nvmf,unknown", err: "unknown collector"},
+  }
+
+  for _,test := range tests {
+    parsed,err := parseTargets(test.specs, test.collectors)
+    if test.err != "" {
+      if err == nil || !strings.Contains(err.Error(), test.err) {
+        t.Errorf("parseTargets(%q, %q) returned error %v, expected %q", test.specs, test.collectors, err, test.err)
+      }
+      continue
+    }
+    if err != nil {
+      t.Errorf("parseTargets(%q, %q) returned error %v", test.specs, test.collectors, err)
+      continue
+    }
+    collectors := map[string][]string{}
+    for _,target := range parsed {
+      collectors[target.Name] = target.Collectors
+    }
+    if !reflect.DeepEqual(collectors, test.expected) {
+      t.Errorf("parseTargets(%q, %q) returned collectors %v, expected %v", test.specs, test.collectors, collectors, test.expected)
+    }
+  }
+}
+
+//##############################################################################
+//# Function: TestCollectTargetOptional
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks that a failure of the ocf collector only
+//#               fails the collection and the readiness of the target when ocf
+//#               was asked for
+//##############################################################################
+func TestCollectTargetOptional(t *testing.T) {
+  address,_ := startRPCServer(t, nil, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"Method not found"}}`)
+
+  // The ocf collector enabled by default, and the one listed in collectors=
+  defaults := newTarget("default-ocf")
+  defaults.Address = address
+  defaults.Collectors = []string{"ocf"}
+  listed,err := parseTarget("name=listed-ocf,address=" + address + ",collectors=ocf", defaultCollectors)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  for _,target := range []*Target{defaults, listed} {
+    err := collectTarget(target)
+    optional := target == defaults
+    if (err == nil) != optional {
+      t.Errorf("%s: collectTarget returned error %v", target.Name, err)
+    }
+    if targetReport(target).Ready != optional {
+      t.Errorf("%s: the target is ready %v, expected %v", target.Name, !optional, optional)
+    }
+    removeTarget(target)
+  }
+}
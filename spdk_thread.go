@@ -0,0 +1,245 @@
+//##############################################################################
+//# spdk_thread.go
+//#
+//#
+//# Description:  Collector for the SPDK threads, pollers and reactors.  It uses
+//#               the SPDK thread_get_stats, thread_get_pollers and
+//#               framework_get_reactors RPCs so the reactor load can be
+//#               correlated with the bdev IO performance
+//##############################################################################
+
+package main
+
+import (
+    "encoding/json"
+    "strconv"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// Definitions of strucs that will be used to parse data
+type THREAD_stat struct {
+  Name string
+  Id float64
+  Cpumask string
+  Busy float64
+  Idle float64
+  Active_pollers_count float64
+  Timed_pollers_count float64
+  Paused_pollers_count float64
+}
+
+type ThreadStat struct {
+  Tick_rate float64
+  Threads []THREAD_stat
+}
+
+type THREAD_poller struct {
+  Name string
+  Id float64
+  State string
+  Run_count float64
+  Busy_count float64
+  Period_ticks float64
+}
+
+type THREAD_pollers struct {
+  Name string
+  Id float64
+  Active_pollers []THREAD_poller
+  Timed_pollers []THREAD_poller
+  Paused_pollers []THREAD_poller
+}
+
+type ThreadPollers struct {
+  Tick_rate float64
+  Threads []THREAD_pollers
+}
+
+type REACTOR_thread struct {
+  Name string
+  Id float64
+  Cpumask string
+  Elapsed float64
+}
+
+type REACTOR_stat struct {
+  Lcore float64
+  Busy float64
+  Idle float64
+  In_interrupt bool
+  Lw_threads []REACTOR_thread
+}
+
+type ReactorStat struct {
+  Tick_rate float64
+  Reactors []REACTOR_stat
+}
+
+// Definitions of metrics
+var (
+  THREAD_busy_ticks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_thread_busy_ticks_total",
+			Help: "Number of ticks the SPDK thread was busy",
+		},
+		[]string{"target", "thread"},
+	)
+  THREAD_idle_ticks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_thread_idle_ticks_total",
+			Help: "Number of ticks the SPDK thread was idle",
+		},
+		[]string{"target", "thread"},
+	)
+  THREAD_poller_count = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_thread_pollers",
+			Help: "Number of pollers of the SPDK thread by type",
+		},
+		[]string{"target", "thread", "type"},
+	)
+
+  POLLER_run_count = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_poller_run_count_total",
+			Help: "Number of times the poller was run",
+		},
+		[]string{"target", "thread", "poller", "poller_id", "type"},
+	)
+  POLLER_busy_count = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_poller_busy_count_total",
+			Help: "Number of times the poller found work to do",
+		},
+		[]string{"target", "thread", "poller", "poller_id", "type"},
+	)
+
+  REACTOR_busy_ticks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_reactor_busy_ticks_total",
+			Help: "Number of ticks the reactor was busy",
+		},
+		[]string{"target", "lcore"},
+	)
+  REACTOR_idle_ticks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spdk_reactor_idle_ticks_total",
+			Help: "Number of ticks the reactor was idle",
+		},
+		[]string{"target", "lcore"},
+	)
+  REACTOR_in_interrupt = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_reactor_in_interrupt",
+			Help: "1 if the reactor is running in interrupt mode",
+		},
+		[]string{"target", "lcore"},
+	)
+  REACTOR_thread_info = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_reactor_thread_info",
+			Help: "SPDK thread assigned to the reactor, the value is always 1",
+		},
+		[]string{"target", "lcore", "thread"},
+	)
+)
+
+//##############################################################################
+//# Function: recordThreadMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if one of the RPC commands failed or returned invalid data
+//#
+//# Description:  This function executes the RPC commands thread_get_stats,
+//#               thread_get_pollers and framework_get_reactors and records the
+//#               thread, poller and reactor metrics.  The series of destroyed
+//#               threads and pollers are deleted once the whole collection
+//#               succeeded
+//##############################################################################
+func recordThreadMetrics(target *Target) error {
+  var parsed_thread_data ThreadStat
+  var parsed_poller_data ThreadPollers
+  var parsed_reactor_data ReactorStat
+
+  thread_json_data,err := rpcCall(target, "thread_get_stats")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(thread_json_data, &parsed_thread_data); err != nil {
+    return err
+  }
+
+  series := newSeriesSet(target, "thread")
+  for _,thread := range parsed_thread_data.Threads {
+    setSeriesCounter(series, THREAD_busy_ticks, "spdk_thread_busy_ticks_total", prometheus.Labels{"target":target.Name, "thread":thread.Name}, thread.Busy)
+    setSeriesCounter(series, THREAD_idle_ticks, "spdk_thread_idle_ticks_total", prometheus.Labels{"target":target.Name, "thread":thread.Name}, thread.Idle)
+    setSeries(series, THREAD_poller_count, prometheus.Labels{"target":target.Name, "thread":thread.Name, "type":"active"}, thread.Active_pollers_count)
+    setSeries(series, THREAD_poller_count, prometheus.Labels{"target":target.Name, "thread":thread.Name, "type":"timed"}, thread.Timed_pollers_count)
+    setSeries(series, THREAD_poller_count, prometheus.Labels{"target":target.Name, "thread":thread.Name, "type":"paused"}, thread.Paused_pollers_count)
+  }
+
+  poller_json_data,err := rpcCall(target, "thread_get_pollers")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(poller_json_data, &parsed_poller_data); err != nil {
+    return err
+  }
+
+  for _,thread := range parsed_poller_data.Threads {
+    pollers := map[string][]THREAD_poller{"active":thread.Active_pollers, "timed":thread.Timed_pollers, "paused":thread.Paused_pollers}
+    for poller_type,list := range pollers {
+      for _,poller := range list {
+        // Several pollers of a thread can have the same name, the id keeps them apart
+        labels := prometheus.Labels{"target":target.Name, "thread":thread.Name, "poller":poller.Name, "poller_id":strconv.FormatFloat(poller.Id, 'f', -1, 64), "type":poller_type}
+        setSeriesCounter(series, POLLER_run_count, "spdk_poller_run_count_total", labels, poller.Run_count)
+        setSeriesCounter(series, POLLER_busy_count, "spdk_poller_busy_count_total", labels, poller.Busy_count)
+      }
+    }
+  }
+
+  reactor_json_data,err := rpcCall(target, "framework_get_reactors")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(reactor_json_data, &parsed_reactor_data); err != nil {
+    return err
+  }
+
+  for _,reactor := range parsed_reactor_data.Reactors {
+    lcore := strconv.FormatFloat(reactor.Lcore, 'f', -1, 64)
+    setSeriesCounter(series, REACTOR_busy_ticks, "spdk_reactor_busy_ticks_total", prometheus.Labels{"target":target.Name, "lcore":lcore}, reactor.Busy)
+    setSeriesCounter(series, REACTOR_idle_ticks, "spdk_reactor_idle_ticks_total", prometheus.Labels{"target":target.Name, "lcore":lcore}, reactor.Idle)
+    setSeries(series, REACTOR_in_interrupt, prometheus.Labels{"target":target.Name, "lcore":lcore}, boolToFloat(reactor.In_interrupt))
+
+    for _,thread := range reactor.Lw_threads {
+      setSeries(series, REACTOR_thread_info, prometheus.Labels{"target":target.Name, "lcore":lcore, "thread":thread.Name}, 1)
+    }
+  }
+  deleteStaleSeries(series)
+  return nil
+}
+
+//##############################################################################
+//# Function: init()
+//#
+//# Input:   None
+//# Output:  None
+//#
+//# Description:  This function registers the thread, poller and reactor
+//#               metrics in Prometheus and the thread collector
+//##############################################################################
+func init() {
+  registerMetric(THREAD_busy_ticks)
+  registerMetric(THREAD_idle_ticks)
+  registerMetric(THREAD_poller_count)
+  registerMetric(POLLER_run_count)
+  registerMetric(POLLER_busy_count)
+  registerMetric(REACTOR_busy_ticks)
+  registerMetric(REACTOR_idle_ticks)
+  registerMetric(REACTOR_in_interrupt)
+  registerMetric(REACTOR_thread_info)
+
+  registerCollector("thread", "SPDK threads, pollers and reactors (thread_get_stats, thread_get_pollers, framework_get_reactors)", recordThreadMetrics)
+}
@@ -0,0 +1,400 @@
+//##############################################################################
+//# spdk_top.go
+//#
+//#
+//# Description:  spdk_parser top, an iostat -x like view of the SPDK
+//#               applications in the terminal.  The targets are collected by
+//#               the same collectors as the exporter, without the HTTP server,
+//#               and every sample redraws a table of the bdevs and a panel with
+//#               the OCF hit ratios and occupancy
+//#
+//# Usage:     spdk_parser top [OPTIONS]
+//#
+//#            i, b, l, n  sort the bdevs by IOPS, bandwidth, latency or name
+//#            r           reverse the order
+//#            /           filter the bdevs by name, Enter to apply, Esc to clear
+//#            q           quit
+//##############################################################################
+
+package main
+
+import (
+    "fmt"
+    "os"
+    "os/exec"
+    "os/signal"
+    "sort"
+    "strconv"
+    "strings"
+    "syscall"
+    "time"
+)
+
+// ANSI escape sequences
+const (
+  ansiHome = "\033[H"
+  ansiClearLine = "\033[K"
+  ansiClearScreen = "\033[J"
+  ansiBold = "\033[1m"
+  ansiReverse = "\033[7m"
+  ansiReset = "\033[0m"
+  ansiHideCursor = "\033[?25l"
+  ansiShowCursor = "\033[?25h"
+  ansiAlternateScreen = "\033[?1049h"
+  ansiMainScreen = "\033[?1049l"
+)
+
+// A line of the bdev table
+type TopRow struct {
+  Target string
+  Bdev string
+  Rates BDEV_rates
+}
+
+// State of the top view
+type TopView struct {
+  sort_key byte
+  reverse bool
+  filter string
+  editing bool
+  samples map[string]Sample
+
+  // Size of the terminal, read at start and when it is resized
+  term_rows int
+  term_cols int
+}
+
+var topSortNames = map[byte]string{'i': "IOPS", 'b': "bandwidth", 'l': "latency", 'n': "name"}
+
+//##############################################################################
+//# Function: stty
+//#
+//# Input:   args - the arguments of stty
+//# Output:  The output of stty and an error if it failed
+//#
+//# Description:  This function runs stty on the terminal of spdk_parser
+//##############################################################################
+func stty(args ...string) (string, error) {
+  cmd := exec.Command("stty", args...)
+  cmd.Stdin = os.Stdin
+  output,err := cmd.Output()
+  return strings.TrimSpace(string(output)), err
+}
+
+//##############################################################################
+//# Function: terminalSize
+//#
+//# Input:   None
+//# Output:  The number of rows and columns of the terminal
+//#
+//# Description:  This function gets the size of the terminal, 24x80 when stty
+//#               cannot tell
+//##############################################################################
+func terminalSize() (int, int) {
+  output,err := stty("size")
+  if err == nil {
+    fields := strings.Fields(output)
+    if len(fields) == 2 {
+      rows,row_err := strconv.Atoi(fields[0])
+      cols,col_err := strconv.Atoi(fields[1])
+      if row_err == nil && col_err == nil && rows > 0 && cols > 0 {
+        return rows, cols
+      }
+    }
+  }
+  return 24, 80
+}
+
+//##############################################################################
+//# Function: readKeys
+//#
+//# Input:   keys - the channel the keys are sent to
+//# Output:  None
+//#
+//# Description:  This function reads the keys typed in the terminal one byte
+//#               at a time, the terminal is in cbreak mode
+//##############################################################################
+func readKeys(keys chan byte) {
+  buffer := make([]byte, 1)
+  for {
+    n,err := os.Stdin.Read(buffer)
+    if err != nil {
+      close(keys)
+      return
+    }
+    if n == 1 {
+      keys <- buffer[0]
+    }
+  }
+}
+
+//##############################################################################
+//# Function: averageLatency
+//#
+//# Input:   rates - the rates of a bdev
+//# Output:  The average latency of the reads and writes in microseconds
+//#
+//# Description:  This function weights the read and write latency by the
+//#               number of operations
+//##############################################################################
+func averageLatency(rates BDEV_rates) float64 {
+  ops := rates.Read_ops_per_sec + rates.Write_ops_per_sec
+  if ops == 0 {
+    return 0
+  }
+  return (rates.Read_latency_us * rates.Read_ops_per_sec + rates.Write_latency_us * rates.Write_ops_per_sec) / ops
+}
+
+//##############################################################################
+//# Function: topRows
+//#
+//# Input:   view - the state of the top view
+//# Output:  The bdevs to show, filtered and sorted
+//#
+//# Description:  This function builds the lines of the bdev table from the last
+//#               sample of every target
+//##############################################################################
+func topRows(view *TopView) []TopRow {
+  var rows []TopRow
+  filter := strings.ToLower(view.filter)
+  for _,sample := range view.samples {
+    for name,rates := range sample.Bdevs {
+      if filter != "" && !strings.Contains(strings.ToLower(name), filter) {
+        continue
+      }
+      rows = append(rows, TopRow{Target: sample.Target, Bdev: name, Rates: rates})
+    }
+  }
+
+  value := func(row TopRow) float64 {
+    switch view.sort_key {
+    case 'b':
+      return row.Rates.Read_bytes_per_sec + row.Rates.Write_bytes_per_sec
+    case 'l':
+      return averageLatency(row.Rates)
+    }
+    return row.Rates.Read_ops_per_sec + row.Rates.Write_ops_per_sec + row.Rates.Unmap_ops_per_sec
+  }
+  sort.SliceStable(rows, func(i, j int) bool {
+    name_i := rows[i].Target + "/" + rows[i].Bdev
+    name_j := rows[j].Target + "/" + rows[j].Bdev
+    // Names ascending and values descending unless reversed
+    if view.sort_key == 'n' || value(rows[i]) == value(rows[j]) {
+      return (name_i < name_j) != (view.reverse && view.sort_key == 'n')
+    }
+    return (value(rows[i]) > value(rows[j])) != view.reverse
+  })
+  return rows
+}
+
+//##############################################################################
+//# Function: renderTop
+//#
+//# Input:   view - the state of the top view
+//# Output:  The screen to print
+//#
+//# Description:  This function draws the header, the bdev table, the OCF panel
+//#               and the key help, cut to the size of the terminal
+//##############################################################################
+func renderTop(view *TopView) string {
+  var screen strings.Builder
+  term_rows,term_cols := view.term_rows,view.term_cols
+
+  line := func(format string, args ...interface{}) {
+    text := fmt.Sprintf(format, args...)
+    if len(text) > term_cols {
+      text = text[:term_cols]
+    }
+    screen.WriteString(text + ansiClearLine + "\r\n")
+  }
+
+  // Drawing over the previous screen does not flicker like clearing it
+  screen.WriteString(ansiHome)
+  order := "descending"
+  if view.sort_key == 'n' {
+    order = "ascending"
+  }
+  if view.reverse {
+    order = map[string]string{"ascending": "descending", "descending": "ascending"}[order]
+  }
+  filter := view.filter
+  if view.editing {
+    filter += "_"
+  }
+  screen.WriteString(ansiBold)
+  line("spdk_parser top - %s  targets: %d  sort: %s %s  filter: %s", time.Now().Format("15:04:05"), len(targets), topSortNames[view.sort_key], order, filter)
+  screen.WriteString(ansiReset)
+
+  // The OCF panel goes below the bdev table
+  var ocf_lines []string
+  for _,target := range targets {
+    sample,ok := view.samples[target.Name]
+    if !ok || sample.Ocf == nil {
+      continue
+    }
+    ocf := sample.Ocf
+    read_hit_ratio, write_hit_ratio := 0.0, 0.0
+    if reads := ocf.Read_hits + ocf.Read_partial_misses + ocf.Read_full_misses; reads > 0 {
+      read_hit_ratio = ocf.Read_hits / reads
+    }
+    if writes := ocf.Write_hits + ocf.Write_partial_misses + ocf.Write_full_misses; writes > 0 {
+      write_hit_ratio = ocf.Write_hits / writes
+    }
+    ocf_lines = append(ocf_lines, fmt.Sprintf("%-12s %-12s %6.1f %6.1f %6.1f %9.0f %9.0f %9.0f %9.0f %6.1f %6.1f %6.1f %6.1f",
+      target.Name, target.Cache, ocf.Hit_ratio * 100, read_hit_ratio * 100, write_hit_ratio * 100,
+      ocf.Read_hits + ocf.Write_hits, ocf.Read_partial_misses + ocf.Write_partial_misses, ocf.Read_full_misses + ocf.Write_full_misses,
+      ocf.Pass_through, ocf.Occupancy_percent, ocf.Clean_percent, ocf.Dirty_percent, ocf.Free_percent))
+  }
+
+  rows := topRows(view)
+  // Header, table header, OCF panel with its title and header, key help
+  max_rows := term_rows - 4
+  if len(ocf_lines) > 0 {
+    max_rows -= len(ocf_lines) + 3
+  }
+  if max_rows < 1 {
+    max_rows = 1
+  }
+
+  line("")
+  screen.WriteString(ansiReverse)
+  line("%-12s %-24s %9s %9s %9s %11s %11s %11s %9s %9s %9s", "TARGET", "BDEV", "IOPS", "READ/S", "WRITE/S", "MiB/S", "READ MiB/S", "WRITE MiB/S", "LAT us", "R_LAT us", "W_LAT us")
+  screen.WriteString(ansiReset)
+  if len(rows) == 0 {
+    line("waiting for two collections of the bdevs...")
+  }
+  for i,row := range rows {
+    if i == max_rows {
+      line("... %d more bdevs", len(rows) - i)
+      break
+    }
+    rates := row.Rates
+    line("%-12s %-24s %9.0f %9.0f %9.0f %11.2f %11.2f %11.2f %9.1f %9.1f %9.1f", row.Target, row.Bdev,
+      rates.Read_ops_per_sec + rates.Write_ops_per_sec + rates.Unmap_ops_per_sec, rates.Read_ops_per_sec, rates.Write_ops_per_sec,
+      (rates.Read_bytes_per_sec + rates.Write_bytes_per_sec) / 1048576, rates.Read_bytes_per_sec / 1048576, rates.Write_bytes_per_sec / 1048576,
+      averageLatency(rates), rates.Read_latency_us, rates.Write_latency_us)
+  }
+
+  if len(ocf_lines) > 0 {
+    line("")
+    screen.WriteString(ansiBold)
+    line("OCF")
+    screen.WriteString(ansiReset + ansiReverse)
+    line("%-12s %-12s %6s %6s %6s %9s %9s %9s %9s %6s %6s %6s %6s", "TARGET", "CACHE", "HIT%", "RD%", "WR%", "HITS", "P_MISS", "F_MISS", "PT", "OCC%", "CLEAN%", "DIRTY%", "FREE%")
+    screen.WriteString(ansiReset)
+    for _,ocf_line := range ocf_lines {
+      line("%s", ocf_line)
+    }
+  }
+
+  line("")
+  line("i:IOPS b:bandwidth l:latency n:name r:reverse /:filter Esc:clear filter q:quit")
+  screen.WriteString(ansiClearScreen)
+  return screen.String()
+}
+
+//##############################################################################
+//# Function: handleTopKey
+//#
+//# Input:   view - the state of the top view
+//#          key  - the key typed
+//# Output:  True when the key quits top
+//#
+//# Description:  This function changes the sort order and the filter.  While
+//#               the filter is edited the keys are added to it
+//##############################################################################
+func handleTopKey(view *TopView, key byte) bool {
+  if view.editing {
+    switch {
+    case key == '\r' || key == '\n':
+      view.editing = false
+    case key == 27:
+      view.filter = ""
+      view.editing = false
+    case key == 127 || key == 8:
+      if len(view.filter) > 0 {
+        view.filter = view.filter[:len(view.filter) - 1]
+      }
+    case key >= ' ' && key < 127:
+      view.filter += string(key)
+    }
+    return false
+  }
+
+  switch key {
+  case 'q', 'Q':
+    return true
+  case 'i', 'b', 'l', 'n':
+    view.sort_key = key
+    view.reverse = false
+  case 'r':
+    view.reverse = !view.reverse
+  case '/':
+    view.editing = true
+  case 27:
+    view.filter = ""
+  }
+  return false
+}
+
+//##############################################################################
+//# Function: runTop
+//#
+//# Input:   None
+//# Output:  The exit code of spdk_parser
+//#
+//# Description:  This function starts the collection of every target and
+//#               redraws the view after every sample, key, resize or second
+//#               until q or Ctrl-C.  The terminal is put in cbreak mode without
+//#               echo and restored on exit
+//##############################################################################
+func runTop() int {
+  saved,err := stty("-g")
+  if err != nil {
+    fmt.Println("ERROR: spdk_parser top needs a terminal: " + err.Error())
+    return 1
+  }
+  if _,err = stty("cbreak", "-echo"); err != nil {
+    fmt.Println("ERROR: Unable to set up the terminal: " + err.Error())
+    return 1
+  }
+  fmt.Print(ansiAlternateScreen + ansiHideCursor)
+  defer func() {
+    fmt.Print(ansiShowCursor + ansiMainScreen)
+    stty(saved)
+  }()
+
+  view := &TopView{sort_key: 'i', samples: map[string]Sample{}}
+  view.term_rows,view.term_cols = terminalSize()
+  subscriber := subscribeSamples()
+  defer unsubscribeSamples(subscriber)
+  for _,target := range targets {
+    recordTargetMetrics(target)
+  }
+
+  keys := make(chan byte, 16)
+  go readKeys(keys)
+  signals := make(chan os.Signal, 1)
+  signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+  resize := make(chan os.Signal, 1)
+  signal.Notify(resize, syscall.SIGWINCH)
+  refresh := time.NewTicker(time.Second)
+  defer refresh.Stop()
+
+  for {
+    fmt.Print(renderTop(view))
+    select {
+    case sample := <-subscriber:
+      view.samples[sample.Target] = sample
+    case key,ok := <-keys:
+      if !ok || handleTopKey(view, key) {
+        return 0
+      }
+    case <-signals:
+      return 0
+    case <-resize:
+      view.term_rows,view.term_cols = terminalSize()
+    case <-refresh.C:
+    }
+  }
+}
@@ -0,0 +1,62 @@
+//##############################################################################
+//# spdk_top_test.go
+//#
+//#
+//# Description:  Tests of the bdev table of spdk_parser top
+//##############################################################################
+
+package main
+
+import (
+    "reflect"
+    "testing"
+)
+
+//##############################################################################
+//# Function: TestTopRows
+//#
+//# Input:   t - the test
+//# Output:  None
+//#
+//# Description:  This function checks the sort keys, the reverse order and the
+//#               filter of the bdev table
+//##############################################################################
+func TestTopRows(t *testing.T) {
+  samples := map[string]Sample{
+    "nvmf": {Target: "nvmf", Bdevs: map[string]BDEV_rates{
+      "Nvme0n1": {Read_ops_per_sec: 1000, Read_bytes_per_sec: 4096000, Read_latency_us: 50},
+      "Cache1": {Read_ops_per_sec: 3000, Write_ops_per_sec: 1000, Read_bytes_per_sec: 1024000, Read_latency_us: 10, Write_latency_us: 30},
+    }},
+    "vhost": {Target: "vhost", Bdevs: map[string]BDEV_rates{
+      "Malloc0": {Write_ops_per_sec: 2000, Write_bytes_per_sec: 8192000, Write_latency_us: 5},
+      "Nvme1n1": {},
+    }},
+  }
+
+  tests := []struct {
+    name string
+    sort_key byte
+    reverse bool
+    filter string
+    expected []string
+  }{
+    {name: "IOPS", sort_key: 'i', expected: []string{"nvmf/Cache1", "vhost/Malloc0", "nvmf/Nvme0n1", "vhost/Nvme1n1"}},
+    {name: "IOPS reversed", sort_key: 'i', reverse: true, expected: []string{"vhost/Nvme1n1", "nvmf/Nvme0n1", "vhost/Malloc0", "nvmf/Cache1"}},
+    {name: "bandwidth", sort_key: 'b', expected: []string{"vhost/Malloc0", "nvmf/Nvme0n1", "nvmf/Cache1", "vhost/Nvme1n1"}},
+    {name: "latency", sort_key: 'l', expected: []string{"nvmf/Nvme0n1", "nvmf/Cache1", "vhost/Malloc0", "vhost/Nvme1n1"}},
+    {name: "name", sort_key: 'n', expected: []string{"nvmf/Cache1", "nvmf/Nvme0n1", "vhost/Malloc0", "vhost/Nvme1n1"}},
+    {name: "name reversed", sort_key: 'n', reverse: true, expected: []string{"vhost/Nvme1n1", "vhost/Malloc0", "nvmf/Nvme0n1", "nvmf/Cache1"}},
+    {name: "filter", sort_key: 'i', filter: "NVME", expected: []string{"nvmf/Nvme0n1", "vhost/Nvme1n1"}},
+  }
+
+  for _,test := range tests {
+    view := &TopView{sort_key: test.sort_key, reverse: test.reverse, filter: test.filter, samples: samples}
+    var names []string
+    for _,row := range topRows(view) {
+      names = append(names, row.Target + "/" + row.Bdev)
+    }
+    if !reflect.DeepEqual(names, test.expected) {
+      t.Errorf("%s: topRows returned %v, expected %v", test.name, names, test.expected)
+    }
+  }
+}
@@ -0,0 +1,321 @@
+//##############################################################################
+//# spdk_topology.go
+//#
+//#
+//# Description:  Builds the dependency graph of the SPDK bdevs: which bdev is
+//#               built on top of which (OCF caches and cores, lvol stores, RAID
+//#               members, split and passthru bases) and which bdevs are exported
+//#               as NVMe-oF namespaces.  The graph is served at /topology as
+//#               JSON or Graphviz DOT and recorded as spdk_bdev_parent metrics
+//##############################################################################
+
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "strconv"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// Definitions of strucs that will be used to parse data
+type OCF_bdev_part struct {
+  Name string
+  Attached bool
+}
+
+type OCF_bdev struct {
+  Name string
+  Started bool
+  Mode string
+  Cache OCF_bdev_part
+  Core OCF_bdev_part
+}
+
+// Definitions of the graph
+type TopologyNode struct {
+  Name string `json:"name"`
+  Type string `json:"type"`
+  Driver string `json:"driver"`
+  Claimed bool `json:"claimed"`
+}
+
+type TopologyEdge struct {
+  Name string `json:"name"`
+  Parent string `json:"parent"`
+  Relation string `json:"relation"`
+}
+
+type Topology struct {
+  Nodes []TopologyNode `json:"nodes"`
+  Edges []TopologyEdge `json:"edges"`
+}
+
+// Definitions of metrics
+var (
+  TOPOLOGY_parent = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_bdev_parent",
+			Help: "The bdev is built on top of the parent bdev, the value is always 1",
+		},
+		[]string{"target", "bdev_name", "parent", "relation"},
+	)
+)
+
+//##############################################################################
+//# Function: bdevDriver
+//#
+//# Input:   bdev - the bdev returned by bdev_get_bdevs
+//# Output:  The name of the module that created the bdev if it is known
+//#
+//# Description:  This function finds the bdev module from the driver specific
+//#               data of the bdev
+//##############################################################################
+func bdevDriver(bdev BDEV_info) string {
+  driver := bdev.Driver_specific
+  switch {
+  case driver.Lvol != nil:     return "lvol"
+  case driver.Raid != nil:     return "raid"
+  case driver.Split != nil:    return "split"
+  case driver.Passthru != nil: return "passthru"
+  case driver.Crypto != nil:   return "crypto"
+  case len(driver.Nvme) > 0:   return "nvme"
+  }
+  return ""
+}
+
+//##############################################################################
+//# Function: buildTopology
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  The bdev graph and an error if the bdevs could not be listed
+//#
+//# Description:  This function executes the RPC command bdev_get_bdevs and,
+//#               when they are available, bdev_lvol_get_lvstores,
+//#               bdev_ocf_get_bdevs and nvmf_get_subsystems.  The optional RPCs
+//#               fail when the module is not loaded in the SPDK application,
+//#               in that case the related edges are left out
+//##############################################################################
+func buildTopology(target *Target) (*Topology, error) {
+  var bdevs []BDEV_info
+  var lvstores []LVOL_store
+  var ocf_bdevs []OCF_bdev
+  var subsystems []NVMF_subsystem
+  topology := &Topology{}
+
+  bdevs_json_data,err := rpcCall(target, "bdev_get_bdevs")
+  if err != nil {
+    return nil, err
+  }
+  if err = json.Unmarshal(bdevs_json_data, &bdevs); err != nil {
+    return nil, err
+  }
+
+  if lvstores_json_data,err := rpcCall(target, "bdev_lvol_get_lvstores"); err == nil {
+    json.Unmarshal(lvstores_json_data, &lvstores)
+  }
+  if ocf_json_data,err := rpcCall(target, "bdev_ocf_get_bdevs"); err == nil {
+    json.Unmarshal(ocf_json_data, &ocf_bdevs)
+  }
+  if subsystems_json_data,err := rpcCall(target, "nvmf_get_subsystems"); err == nil {
+    json.Unmarshal(subsystems_json_data, &subsystems)
+  }
+
+  lvstore_base := map[string]string{}
+  for _,lvstore := range lvstores {
+    lvstore_base[lvstore.Uuid] = lvstore.Base_bdev
+  }
+
+  addEdge := func(name string, parent string, relation string) {
+    if parent != "" {
+      topology.Edges = append(topology.Edges, TopologyEdge{Name: name, Parent: parent, Relation: relation})
+    }
+  }
+
+  for _,bdev := range bdevs {
+    driver := bdevDriver(bdev)
+    topology.Nodes = append(topology.Nodes, TopologyNode{Name: bdev.Name, Type: bdev.Product_name, Driver: driver, Claimed: bdev.Claimed})
+
+    specific := bdev.Driver_specific
+    switch driver {
+    case "lvol":
+      base := specific.Lvol.Base_bdev
+      if base == "" {
+        base = lvstore_base[specific.Lvol.Lvol_store_uuid]
+      }
+      addEdge(bdev.Name, base, "lvol")
+      if specific.Lvol.Clone {
+        addEdge(bdev.Name, specific.Lvol.Base_snapshot, "clone")
+      }
+    case "raid":
+      for _,base_json_data := range specific.Raid.Base_bdevs_list {
+        addEdge(bdev.Name, parseRaidBaseBdev(base_json_data).Name, "raid_member")
+      }
+    case "split":
+      addEdge(bdev.Name, specific.Split.Base_bdev, "split")
+    case "passthru":
+      addEdge(bdev.Name, specific.Passthru.Base_bdev_name, "passthru")
+    case "crypto":
+      addEdge(bdev.Name, specific.Crypto.Base_bdev_name, "crypto")
+    }
+  }
+
+  for _,ocf := range ocf_bdevs {
+    addEdge(ocf.Name, ocf.Cache.Name, "ocf_cache")
+    addEdge(ocf.Name, ocf.Core.Name, "ocf_core")
+  }
+
+  for _,subsystem := range subsystems {
+    for _,namespace := range subsystem.Namespaces {
+      name := subsystem.Nqn + "/ns" + strconv.FormatFloat(namespace.Nsid, 'f', -1, 64)
+      topology.Nodes = append(topology.Nodes, TopologyNode{Name: name, Type: "NVMe-oF namespace", Driver: "nvmf"})
+      addEdge(name, namespace.Bdev_name, "nvmf_namespace")
+    }
+  }
+
+  sort.Slice(topology.Edges, func(i, j int) bool {
+    if topology.Edges[i].Name != topology.Edges[j].Name {
+      return topology.Edges[i].Name < topology.Edges[j].Name
+    }
+    return topology.Edges[i].Parent < topology.Edges[j].Parent
+  })
+  return topology, nil
+}
+
+//##############################################################################
+//# Function: topologyMatches
+//#
+//# Input:   topology - the bdev graph
+//#          bdevs    - the bdevs returned by get_bdevs_iostat
+//# Output:  true if the graph has exactly the given bdevs
+//#
+//# Description:  This function tells if a bdev graph built earlier is still
+//#               current.  The graph only changes when bdevs are created or
+//#               deleted, so the graph has to be rebuilt when its bdevs differ
+//#               from the bdevs of the iostat data
+//##############################################################################
+func topologyMatches(topology *Topology, bdevs []Bdev) bool {
+  names := map[string]bool{}
+  for _,node := range topology.Nodes {
+    // NVMe-oF namespaces are nodes of the graph but not bdevs
+    if node.Driver != "nvmf" {
+      names[node.Name] = true
+    }
+  }
+  if len(names) != len(bdevs) {
+    return false
+  }
+  for _,bdev := range bdevs {
+    if !names[bdev.Name] {
+      return false
+    }
+  }
+  return true
+}
+
+//##############################################################################
+//# Function: writeTopologyDot
+//#
+//# Input:   w        - where to write the graph
+//#          topology - the bdev graph
+//# Output:  None
+//#
+//# Description:  This function writes the bdev graph in Graphviz DOT format with
+//#               the physical devices at the bottom
+//##############################################################################
+func writeTopologyDot(w io.Writer, topology *Topology) {
+  fmt.Fprintln(w, "digraph spdk {")
+  fmt.Fprintln(w, "  rankdir=TB;")
+  fmt.Fprintln(w, "  node [shape=box];")
+  for _,node := range topology.Nodes {
+    fmt.Fprintf(w, "  %q [label=%q];\n", node.Name, node.Name + "\n" + node.Type)
+  }
+  for _,edge := range topology.Edges {
+    fmt.Fprintf(w, "  %q -> %q [label=%q];\n", edge.Name, edge.Parent, edge.Relation)
+  }
+  fmt.Fprintln(w, "}")
+}
+
+//##############################################################################
+//# Function: topologyHandler
+//#
+//# Input:   w - the HTTP response
+//#          r - the HTTP request, ?format=dot returns Graphviz DOT and
+//#              ?target=NAME selects the target, the first one by default
+//# Output:  None
+//#
+//# Description:  This function serves the bdev graph at /topology.  The graph is
+//#               built on each request so it is available even when the
+//#               topology collector is not enabled
+//##############################################################################
+func topologyHandler(w http.ResponseWriter, r *http.Request) {
+  target := findTarget(r.URL.Query().Get("target"))
+  if target == nil {
+    http.Error(w, "unknown target " + r.URL.Query().Get("target"), http.StatusNotFound)
+    return
+  }
+
+  topology,err := buildTopology(target)
+  if err != nil {
+    http.Error(w, err.Error(), http.StatusServiceUnavailable)
+    return
+  }
+
+  if r.URL.Query().Get("format") == "dot" {
+    w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+    writeTopologyDot(w, topology)
+    return
+  }
+  w.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(w).Encode(topology)
+}
+
+//##############################################################################
+//# Function: recordTopologyMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if the bdev graph could not be built
+//#
+//# Description:  This function builds the bdev graph and records one
+//#               spdk_bdev_parent metric for every edge between two bdevs.
+//#               The graph is kept for the aggregate collector
+//##############################################################################
+func recordTopologyMetrics(target *Target) error {
+  topology,err := buildTopology(target)
+  if err != nil {
+    return err
+  }
+
+  target.topology = topology
+
+  series := newSeriesSet(target, "topology")
+  for _,edge := range topology.Edges {
+    // NVMe-oF namespaces are not bdevs, spdk_nvmf_subsystem_namespace_info
+    // already joins them with the bdev metrics
+    if edge.Relation == "nvmf_namespace" {
+      continue
+    }
+    setSeries(series, TOPOLOGY_parent, prometheus.Labels{"target":target.Name, "bdev_name":edge.Name, "parent":edge.Parent, "relation":edge.Relation}, 1)
+  }
+  deleteStaleSeries(series)
+  return nil
+}
+
+//##############################################################################
+//# Function: init()
+//#
+//# Input:   None
+//# Output:  None
+//#
+//# Description:  This function registers the topology metrics in Prometheus and
+//#               the topology collector
+//##############################################################################
+func init() {
+  registerMetric(TOPOLOGY_parent)
+
+  registerCollector("topology", "bdev dependency graph, also served at /topology (bdev_get_bdevs, bdev_lvol_get_lvstores, bdev_ocf_get_bdevs, nvmf_get_subsystems)", recordTopologyMetrics)
+}
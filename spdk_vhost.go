@@ -0,0 +1,187 @@
+//##############################################################################
+//# spdk_vhost.go
+//#
+//#
+//# Description:  Collector for the SPDK vhost-user-blk and vhost-user-scsi
+//#               controllers returned by the vhost_get_controllers RPC
+//##############################################################################
+
+package main
+
+import (
+    "encoding/json"
+    "strconv"
+
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// Definitions of strucs that will be used to parse data
+type VHOST_session struct {
+  Vid float64
+  Id float64
+  Name string
+  Started bool
+}
+
+type VHOST_scsi_lun struct {
+  Id float64
+  Bdev_name string
+}
+
+type VHOST_scsi_target struct {
+  Target_name string
+  Id float64
+  Scsi_dev_num float64
+  Luns []VHOST_scsi_lun
+}
+
+type VHOST_blk struct {
+  Bdev string
+  Readonly bool
+  Transport string
+}
+
+type VHOST_backend struct {
+  Scsi []VHOST_scsi_target
+  Block *VHOST_blk
+}
+
+type VHOST_controller struct {
+  Ctrlr string
+  Cpumask string
+  Socket string
+  Delay_base_us float64
+  Iops_threshold float64
+  Sessions []VHOST_session
+  Backend_specific VHOST_backend
+}
+
+// Definitions of metrics
+var (
+  VHOST_controller_info = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_vhost_controller_info",
+			Help: "vhost controller information, the value is always 1",
+		},
+		[]string{"target", "controller", "backend", "cpumask", "socket"},
+	)
+  VHOST_delay_base_us = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_vhost_controller_delay_base_us",
+			Help: "Interrupt coalescing base delay in microseconds",
+		},
+		[]string{"target", "controller"},
+	)
+  VHOST_iops_threshold = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_vhost_controller_iops_threshold",
+			Help: "Interrupt coalescing IOPS threshold",
+		},
+		[]string{"target", "controller"},
+	)
+  VHOST_sessions = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_vhost_controller_sessions",
+			Help: "Number of vhost sessions of the controller",
+		},
+		[]string{"target", "controller"},
+	)
+  VHOST_connected = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_vhost_controller_connected",
+			Help: "Number of started vhost sessions of the controller, 0 when no VM is connected",
+		},
+		[]string{"target", "controller"},
+	)
+  VHOST_readonly = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_vhost_blk_readonly",
+			Help: "1 if the vhost-user-blk controller is read only",
+		},
+		[]string{"target", "controller"},
+	)
+  VHOST_lun_info = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "spdk_vhost_lun_info",
+			Help: "vhost controller LUN and its backing bdev, the value is always 1",
+		},
+		[]string{"target", "controller", "scsi_target", "lun", "bdev_name"},
+	)
+)
+
+//##############################################################################
+//# Function: recordVhostMetrics
+//#
+//# Input:   target - the SPDK application to collect from
+//# Output:  An error if the RPC command failed or returned invalid data
+//#
+//# Description:  This function executes the RPC command vhost_get_controllers
+//#               and records the vhost controller metrics
+//##############################################################################
+func recordVhostMetrics(target *Target) error {
+  var controllers []VHOST_controller
+
+  vhost_json_data,err := rpcCall(target, "vhost_get_controllers")
+  if err != nil {
+    return err
+  }
+  if err = json.Unmarshal(vhost_json_data, &controllers); err != nil {
+    return err
+  }
+
+  series := newSeriesSet(target, "vhost")
+
+  for _,controller := range controllers {
+    backend := "scsi"
+    if controller.Backend_specific.Block != nil {
+      backend = "blk"
+    }
+    setSeries(series, VHOST_controller_info, prometheus.Labels{"target":target.Name, "controller":controller.Ctrlr, "backend":backend, "cpumask":controller.Cpumask, "socket":controller.Socket}, 1)
+    setSeries(series, VHOST_delay_base_us, prometheus.Labels{"target":target.Name, "controller":controller.Ctrlr}, controller.Delay_base_us)
+    setSeries(series, VHOST_iops_threshold, prometheus.Labels{"target":target.Name, "controller":controller.Ctrlr}, controller.Iops_threshold)
+
+    started := 0
+    for _,session := range controller.Sessions {
+      if session.Started {
+        started++
+      }
+    }
+    setSeries(series, VHOST_sessions, prometheus.Labels{"target":target.Name, "controller":controller.Ctrlr}, float64(len(controller.Sessions)))
+    setSeries(series, VHOST_connected, prometheus.Labels{"target":target.Name, "controller":controller.Ctrlr}, float64(started))
+
+    if blk := controller.Backend_specific.Block; blk != nil {
+      setSeries(series, VHOST_readonly, prometheus.Labels{"target":target.Name, "controller":controller.Ctrlr}, boolToFloat(blk.Readonly))
+      setSeries(series, VHOST_lun_info, prometheus.Labels{"target":target.Name, "controller":controller.Ctrlr, "scsi_target":"", "lun":"0", "bdev_name":blk.Bdev}, 1)
+    }
+
+    for _,scsi_target := range controller.Backend_specific.Scsi {
+      for _,lun := range scsi_target.Luns {
+        setSeries(series, VHOST_lun_info, prometheus.Labels{"target":target.Name, "controller":controller.Ctrlr, "scsi_target":strconv.FormatFloat(scsi_target.Scsi_dev_num, 'f', -1, 64),
+                                                            "lun":strconv.FormatFloat(lun.Id, 'f', -1, 64), "bdev_name":lun.Bdev_name}, 1)
+      }
+    }
+  }
+  deleteStaleSeries(series)
+  return nil
+}
+
+//##############################################################################
+//# Function: init()
+//#
+//# Input:   None
+//# Output:  None
+//#
+//# Description:  This function registers the vhost metrics in Prometheus and
+//#               the vhost collector
+//##############################################################################
+func init() {
+  registerMetric(VHOST_controller_info)
+  registerMetric(VHOST_delay_base_us)
+  registerMetric(VHOST_iops_threshold)
+  registerMetric(VHOST_sessions)
+  registerMetric(VHOST_connected)
+  registerMetric(VHOST_readonly)
+  registerMetric(VHOST_lun_info)
+
+  registerCollector("vhost", "vhost-user-blk and vhost-user-scsi controllers (vhost_get_controllers)", recordVhostMetrics)
+}